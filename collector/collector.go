@@ -18,120 +18,90 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"github.com/mef13/flussonic_exporter/flussonic"
 	"github.com/mef13/flussonic_exporter/logger"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
+	"net"
+	"sort"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
-const namespace = "flussonic"
-
-var (
-	scrapeDurationDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `scrape`, `collector_duration_seconds`),
-		`flussonic_exporter: Duration of a collector scrape.`,
-		[]string{`server`},
-		nil,
-	)
-	scrapeSuccessDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `scrape`, `collector_success`),
-		`flussonic_exporter: Whether a collector succeeded.`,
-		[]string{`server`},
-		nil,
-	)
-
-	totalClientsDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `clients`, `total`),
-		`flussonic_exporter: Total clients count.`,
-		[]string{`server`},
-		prometheus.Labels{"type": "total"},
-	)
-	totalDvrClientsDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `clients`, `total`),
-		`flussonic_exporter: Total clients count.`,
-		[]string{`server`},
-		prometheus.Labels{"type": "dvr"},
-	)
-	requestDurationDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `scrape`, `api_request_duration_sec`),
-		`flussonic_exporter: API request duration.`,
-		[]string{`server`, `url`},
-		nil,
-	)
-
-	streamLabels      = []string{`server`, `name`, `title`, `comment`, `dvr_enabled`, `transcoder_enabled`}
-	streamBitrateDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `stream`, `bitrate`),
-		`flussonic_exporter: Stream bitrate.`,
-		streamLabels,
-		nil,
-	)
-	streamRetryCountDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `stream`, `retry_count`),
-		`flussonic_exporter: Stream retry count.`,
-		streamLabels,
-		nil,
-	)
-	streamAliveDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `stream`, `is_alive`),
-		`flussonic_exporter: Is stream alive.`,
-		streamLabels,
-		nil,
-	)
-	streamInputErrorRateDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `stream`, `input_error_rate`),
-		`flussonic_exporter: Stream input error rate.`,
-		streamLabels,
-		nil,
-	)
-	streamTracksCountDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `stream`, `tracks_count`),
-		`flussonic_exporter: Stream tracks count.`,
-		streamLabels,
-		nil,
-	)
-	streamClientsTotalDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `stream`, `clients_count`),
-		`flussonic_exporter: Stream clients count.`,
-		streamLabels,
-		prometheus.Labels{"type": "total"},
-	)
-	streamClientsDvrDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, `stream`, `clients_count`),
-		`flussonic_exporter: Stream clients count.`,
-		streamLabels,
-		prometheus.Labels{"type": "dvr"},
-	)
-)
-
 type FlussonicCollector struct {
+	// sync guards cache map. Saved caches are never modified, so they can be sent without lock.
+	sync  sync.RWMutex
 	cache map[string]*flussonicCollectorCache
+	// retained holds urls of configured instances, nil means all instances are saved.
+	retained map[string]struct{}
+
+	// targets are scraped by Refresh in on-demand mode.
+	targetsSync sync.RWMutex
+	targets     []flussonic.Flussonic
+	refreshSync sync.Mutex
+	// refreshing maps url of target scraped by Refresh to channel closed when its scrape is done.
+	refreshing map[string]chan struct{}
 }
 
+// flussonicCollectorCache holds metrics of one scrape. It's filled before save and read-only after.
 type flussonicCollectorCache struct {
+	instanceName string
+	// cache holds flussonic metrics, they are dropped when cache is older than maxAge.
 	cache []prometheus.Metric
-	sync  sync.RWMutex
+	// scrape holds metrics about scrape itself, they are always sent.
+	scrape      []prometheus.Metric
+	success     bool
+	savedAt     time.Time
+	lastSuccess time.Time
+	maxAge      time.Duration
 }
 
 // Describe implements the prometheus.Collector interface.
 func (c *FlussonicCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- scrapeSuccessDesc
-	ch <- scrapeDurationDesc
+	for _, desc := range descs {
+		ch <- desc
+	}
 }
 
 // Collect implements the prometheus.Collector interface.
 func (c *FlussonicCollector) Collect(ch chan<- prometheus.Metric) {
-	for flussonicUrl := range c.cache {
-		send(ch, c.cache[flussonicUrl])
+	now := time.Now()
+	for _, cache := range c.snapshot() {
+		send(ch, cache, now)
 	}
 }
 
-func send(ch chan<- prometheus.Metric, cache *flussonicCollectorCache) {
-	cache.sync.RLock()
-	defer cache.sync.RUnlock()
+// snapshot returns caches of all instances, so Collect doesn't hold the lock while sending metrics.
+func (c *FlussonicCollector) snapshot() []*flussonicCollectorCache {
+	c.sync.RLock()
+	defer c.sync.RUnlock()
+	caches := make([]*flussonicCollectorCache, 0, len(c.cache))
+	for _, cache := range c.cache {
+		caches = append(caches, cache)
+	}
+	return caches
+}
+
+func send(ch chan<- prometheus.Metric, cache *flussonicCollectorCache, now time.Time) {
+	for _, metric := range cache.scrape {
+		ch <- metric
+	}
+	age := now.Sub(cache.savedAt)
+	ch <- prometheus.MustNewConstMetric(scrapeCacheAgeDesc, prometheus.GaugeValue, age.Seconds(),
+		cache.instanceName)
+	if !cache.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(scrapeLastSuccessDesc, prometheus.GaugeValue,
+			float64(cache.lastSuccess.UnixNano())/float64(time.Second), cache.instanceName)
+	}
+	if cache.maxAge > 0 && age > cache.maxAge {
+		logger.Debug("cache expired", zap.String("instance", cache.instanceName), zap.Duration("age", age))
+		return
+	}
 	for _, metric := range cache.cache {
 		ch <- metric
 	}
@@ -145,156 +115,680 @@ func (c *flussonicCollectorCache) addMetric(m prometheus.Metric) {
 	c.cache = append(c.cache, m)
 }
 
+func (c *flussonicCollectorCache) addScrapeMetric(m prometheus.Metric) {
+	c.scrape = append(c.scrape, m)
+}
+
 func (c *FlussonicCollector) save(flussonicUrl string, cache *flussonicCollectorCache) {
-	_, ok := c.cache[flussonicUrl]
-	if ok {
-		c.cache[flussonicUrl].sync.Lock()
-		defer c.cache[flussonicUrl].sync.Unlock()
+	c.sync.Lock()
+	defer c.sync.Unlock()
+	if c.retained != nil {
+		//instance was removed from config while it was scraped
+		if _, ok := c.retained[flussonicUrl]; !ok {
+			return
+		}
+	}
+	cache.savedAt = time.Now()
+	if cache.success {
+		cache.lastSuccess = cache.savedAt
+	} else if prev, ok := c.cache[flussonicUrl]; ok {
+		cache.lastSuccess = prev.lastSuccess
 	}
 	c.cache[flussonicUrl] = cache
 }
 
-func (c *FlussonicCollector) failScrape(flussConf flussonic.Flussonic, startTime time.Time) {
-	cache := &flussonicCollectorCache{}
-	cache.addMetric(prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, float64(0),
-		flussConf.InstanceName))
-	duration := time.Since(startTime)
-	cache.addMetric(prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(),
-		flussConf.InstanceName))
-	c.save(flussConf.Url.String(), cache)
+// Retain drops caches of instances not in fluss. Scrapes of dropped instances finished later are not saved.
+func (c *FlussonicCollector) Retain(fluss []*flussonic.Flussonic) {
+	retained := make(map[string]struct{}, len(fluss))
+	for _, flus := range fluss {
+		retained[flus.Url.String()] = struct{}{}
+	}
+	c.sync.Lock()
+	defer c.sync.Unlock()
+	for flussonicUrl := range c.cache {
+		if _, ok := retained[flussonicUrl]; !ok {
+			delete(c.cache, flussonicUrl)
+		}
+	}
+	c.retained = retained
 }
 
+// failureReason classifies scrape error, so timeouts can be told apart from refused connections.
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "error"
+}
+
+// Scrape collects metrics from flussonic api and saves them to cache.
+// Scrape is canceled if it doesn't finish within the instance scrape interval.
 func (c *FlussonicCollector) Scrape(flussConf flussonic.Flussonic) {
+	c.scrape(context.Background(), flussConf)
+}
+
+func (c *FlussonicCollector) scrape(ctx context.Context, flussConf flussonic.Flussonic) {
 	logger.Debug("start scrapping", zap.String("instance", flussConf.InstanceName))
 	startTime := time.Now()
-	cache := &flussonicCollectorCache{}
-
-	//get metrics
-	serv, err := flussConf.GetServer()
-	if err != nil {
-		logger.Error("error scrape from flussonic api",
-			zap.String("server", flussConf.Url.String()), zap.String("method", "GetServer"), zap.Error(err))
-		c.failScrape(flussConf, startTime)
-		return
+	cache := &flussonicCollectorCache{instanceName: flussConf.InstanceName, maxAge: flussConf.MaxCacheAge}
+
+	if interval, err := time.ParseDuration(flussConf.ScrapeInterval); err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, interval)
+		defer cancel()
 	}
-	media, err := flussConf.GetMedia()
-	if err != nil {
-		logger.Error("error scrape from flussonic api",
-			zap.String("server", flussConf.Url.String()), zap.String("method", "GetMedia"), zap.Error(err))
-		c.failScrape(flussConf, startTime)
-		return
+
+	//get metrics concurrently, so scrape takes as long as the slowest request
+	var (
+		wg          sync.WaitGroup
+		serv        *flussonic.Server
+		media       *flussonic.Media
+		sessions    *flussonic.Sessions
+		dvr         *flussonic.Dvr
+		disks       *flussonic.Disks
+		servErr     error
+		mediaErr    error
+		sessionsErr error
+		dvrErr      error
+		disksErr    error
+	)
+	wg.Add(3)
+	if flussConf.DiskMetrics {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			disks, disksErr = flussConf.GetDisks(ctx)
+		}()
 	}
-	sessions, err := flussConf.GetSessions()
-	if err != nil {
-		logger.Error("error scrape from flussonic api",
-			zap.String("server", flussConf.Url.String()), zap.String("method", "GetSessions"), zap.Error(err))
-		c.failScrape(flussConf, startTime)
-		return
+	go func() {
+		defer wg.Done()
+		serv, servErr = flussConf.GetServer(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		media, mediaErr = flussConf.GetMedia(ctx)
+		if mediaErr == nil && flussConf.DvrMetrics {
+			dvr, dvrErr = flussConf.GetDvr(ctx, media.DvrStreams())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		sessions, sessionsErr = flussConf.GetSessions(ctx)
+	}()
+	wg.Wait()
+
+	//each endpoint succeeds or fails on its own
+	type endpointResult struct {
+		endpoint string
+		method   string
+		err      error
+	}
+	results := []endpointResult{
+		{"server", "GetServer", servErr},
+		{"media", "GetMedia", mediaErr},
+		{"sessions", "GetSessions", sessionsErr},
+	}
+	//dvr is requested only if media succeeded
+	if dvr != nil {
+		results = append(results, endpointResult{"dvr", "GetDvr", dvrErr})
+	}
+	if flussConf.DiskMetrics {
+		results = append(results, endpointResult{"disks", "GetDisks", disksErr})
+	}
+	var firstErr error
+	succeeded := 0
+	for _, res := range results {
+		success := float64(1)
+		if res.err != nil {
+			success = 0
+			logger.Error("error scrape from flussonic api",
+				zap.String("server", flussConf.Url.String()), zap.String("method", res.method), zap.Error(res.err))
+			if firstErr == nil {
+				firstErr = res.err
+			}
+		} else {
+			succeeded++
+		}
+		cache.addScrapeMetric(prometheus.MustNewConstMetric(scrapeEndpointSuccessDesc, prometheus.GaugeValue, success,
+			flussConf.InstanceName, res.endpoint))
 	}
 
 	//add metrics to cache
-	cache.addMetric(prometheus.MustNewConstMetric(
-		requestDurationDesc,
-		prometheus.GaugeValue,
-		serv.RequestDuration,
-		flussConf.InstanceName,
-		serv.Url,
-	))
-	cache.addMetric(prometheus.MustNewConstMetric(
-		requestDurationDesc,
-		prometheus.GaugeValue,
-		media.RequestDuration,
-		flussConf.InstanceName,
-		media.Url,
-	))
-	cache.addMetric(prometheus.MustNewConstMetric(
-		requestDurationDesc,
-		prometheus.GaugeValue,
-		sessions.RequestDuration,
-		flussConf.InstanceName,
-		sessions.Url,
-	))
-	cache.addMetric(prometheus.MustNewConstMetric(
-		totalClientsDesc,
-		prometheus.GaugeValue,
-		serv.TotalClients,
-		flussConf.InstanceName,
-	))
-	cache.addMetric(prometheus.MustNewConstMetric(
-		totalDvrClientsDesc,
-		prometheus.GaugeValue,
-		sessions.TotalDvrClients,
-		flussConf.InstanceName,
-	))
-
-	//add streams
-	for _, stream := range media.Streams {
-		cache.addMetric(newStreamGaugeMetric(
-			streamBitrateDesc,
-			stream.Stats.Bitrate,
+	if servErr == nil {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			requestDurationDesc,
+			prometheus.GaugeValue,
+			serv.RequestDuration,
 			flussConf.InstanceName,
-			stream,
+			serv.Url,
 		))
-		cache.addMetric(newStreamCounterMetric(
-			streamRetryCountDesc,
-			stream.Stats.RetryCount,
+		cache.addMetric(prometheus.MustNewConstMetric(
+			totalClientsDesc,
+			prometheus.GaugeValue,
+			serv.TotalClients,
 			flussConf.InstanceName,
-			stream,
 		))
-		isAlive := float64(0)
-		if stream.Stats.Alive {
-			isAlive = 1
-		}
-		cache.addMetric(newStreamGaugeMetric(
-			streamAliveDesc,
-			isAlive,
+		addServerMetrics(cache, flussConf.InstanceName, serv)
+	}
+	if mediaErr == nil {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			requestDurationDesc,
+			prometheus.GaugeValue,
+			media.RequestDuration,
 			flussConf.InstanceName,
-			stream,
+			media.Url,
 		))
-		cache.addMetric(newStreamGaugeMetric(
-			streamInputErrorRateDesc,
-			stream.Stats.InputErrorRate,
+	}
+	if sessionsErr == nil {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			requestDurationDesc,
+			prometheus.GaugeValue,
+			sessions.RequestDuration,
 			flussConf.InstanceName,
-			stream,
+			sessions.Url,
 		))
-		cache.addMetric(newStreamGaugeMetric(
-			streamTracksCountDesc,
-			float64(len(stream.Stats.MediaInfo.Tracks)),
+		cache.addMetric(prometheus.MustNewConstMetric(
+			totalDvrClientsDesc,
+			prometheus.GaugeValue,
+			sessions.TotalDvrClients,
 			flussConf.InstanceName,
-			stream,
 		))
-		session, ok := sessions.Sessions[stream.Name]
-		if !ok {
-			session = &flussonic.MediaSessions{
-				Name:         stream.Name,
-				DvrClients:   0,
-				TotalClients: 0,
-				Types:        nil,
-			}
+		for sessionType, count := range sessions.Types {
+			cache.addMetric(prometheus.MustNewConstMetric(
+				clientsByProtocolDesc,
+				prometheus.GaugeValue,
+				count,
+				flussConf.InstanceName,
+				sessionType,
+			))
 		}
-		cache.addMetric(newStreamGaugeMetric(
-			streamClientsTotalDesc,
-			session.TotalClients,
+		cache.addMetric(prometheus.MustNewConstMetric(
+			uniqueIpsDesc,
+			prometheus.GaugeValue,
+			sessions.UniqueIps.Estimate(),
 			flussConf.InstanceName,
-			stream,
 		))
-		cache.addMetric(newStreamGaugeMetric(
-			streamClientsDvrDesc,
-			session.DvrClients,
+		for family, count := range topN(sessions.UserAgents, flussConf.SessionsTopN) {
+			cache.addMetric(prometheus.MustNewConstMetric(
+				clientsByUserAgentDesc,
+				prometheus.GaugeValue,
+				count,
+				flussConf.InstanceName,
+				family,
+			))
+		}
+		for country, count := range topN(sessions.Countries, flussConf.SessionsTopN) {
+			cache.addMetric(prometheus.MustNewConstMetric(
+				clientsByCountryDesc,
+				prometheus.GaugeValue,
+				count,
+				flussConf.InstanceName,
+				country,
+			))
+		}
+	}
+
+	if flussConf.DiskMetrics && disksErr == nil {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			requestDurationDesc,
+			prometheus.GaugeValue,
+			disks.RequestDuration,
 			flussConf.InstanceName,
-			stream,
+			disks.Url,
 		))
+		for _, disk := range disks.Disks {
+			addDiskMetrics(cache, flussConf.InstanceName, disk)
+		}
+	}
+	//dvr may be partially received, statuses of failed streams are omitted
+	if dvr != nil {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			requestDurationDesc,
+			prometheus.GaugeValue,
+			dvr.RequestDuration,
+			flussConf.InstanceName,
+			dvr.Url,
+		))
+	}
+
+	//add streams
+	if mediaErr == nil {
+		for _, stream := range media.Streams {
+			if stream.Options.Disabled && flussConf.SkipDisabledStreams {
+				continue
+			}
+			addStreamMetrics(cache, flussConf.InstanceName, stream)
+			if dvr != nil {
+				if status, ok := dvr.Streams[stream.Name]; ok {
+					addDvrMetrics(cache, flussConf.InstanceName, stream, status)
+				}
+			}
+			//client counts are omitted if sessions are unavailable
+			if sessionsErr == nil {
+				addStreamClientsMetrics(cache, flussConf.InstanceName, stream, sessions)
+			}
+		}
 	}
 
 	//end scrape & save cache
-	cache.addMetric(prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, float64(1),
+	success := float64(0)
+	if succeeded > 0 {
+		success = 1
+	}
+	cache.addScrapeMetric(prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success,
 		flussConf.InstanceName))
+	if firstErr != nil {
+		cache.addScrapeMetric(prometheus.MustNewConstMetric(scrapeFailureDesc, prometheus.GaugeValue, float64(1),
+			flussConf.InstanceName, failureReason(firstErr)))
+	}
 	duration := time.Since(startTime)
-	cache.addMetric(prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(),
+	cache.addScrapeMetric(prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(),
 		flussConf.InstanceName))
+	cache.success = succeeded > 0
 	c.save(flussConf.Url.String(), cache)
 }
 
+func addServerMetrics(cache *flussonicCollectorCache, instanceName string, serv *flussonic.Server) {
+	var licenseValid *float64
+	if serv.LicenseValid != nil {
+		value := boolToFloat(*serv.LicenseValid)
+		licenseValid = &value
+	}
+	for _, m := range []struct {
+		desc  *prometheus.Desc
+		value *float64
+	}{
+		{serverCpuUsageDesc, serv.CpuUsage},
+		{serverMemoryTotalDesc, serv.TotalMemory},
+		{serverMemoryUsedDesc, serv.UsedMemory()},
+		{serverUptimeDesc, serv.Uptime},
+		{serverSchedulerLoadDesc, serv.SchedulerLoad},
+		{serverInputBitrateDesc, serv.InputKbit},
+		{serverOutputBitrateDesc, serv.OutputKbit},
+		{serverLicenseValidDesc, licenseValid},
+	} {
+		//stats not reported by flussonic are skipped rather than exported as 0
+		if m.value == nil {
+			continue
+		}
+		cache.addMetric(prometheus.MustNewConstMetric(
+			m.desc,
+			prometheus.GaugeValue,
+			*m.value,
+			instanceName,
+		))
+	}
+	cache.addMetric(prometheus.MustNewConstMetric(
+		serverInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		instanceName,
+		serv.Version,
+		string(serv.Build),
+		serv.Hostname,
+	))
+}
+
+func addDiskMetrics(cache *flussonicCollectorCache, instanceName string, disk flussonic.Disk) {
+	for _, m := range []struct {
+		desc      *prometheus.Desc
+		valueType prometheus.ValueType
+		value     float64
+	}{
+		{diskTotalBytesDesc, prometheus.GaugeValue, disk.TotalBytes},
+		{diskUsedBytesDesc, prometheus.GaugeValue, disk.UsedBytes},
+		{diskReadErrorsDesc, prometheus.CounterValue, disk.ReadErrors},
+		{diskWriteErrorsDesc, prometheus.CounterValue, disk.WriteErrors},
+	} {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			m.desc,
+			m.valueType,
+			m.value,
+			instanceName,
+			disk.Path,
+			disk.Raid,
+		))
+	}
+	cache.addMetric(prometheus.MustNewConstMetric(
+		diskStatusDesc,
+		prometheus.GaugeValue,
+		boolToFloat(disk.IsHealthy()),
+		instanceName,
+		disk.Path,
+		disk.Raid,
+		disk.Status,
+	))
+}
+
+func addStreamMetrics(cache *flussonicCollectorCache, instanceName string, stream *flussonic.Stream) {
+	cache.addMetric(newStreamGaugeMetric(
+		streamBitrateDesc,
+		stream.Stats.Bitrate,
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamCounterMetric(
+		streamRetryCountDesc,
+		stream.Stats.RetryCount,
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamGaugeMetric(
+		streamAliveDesc,
+		boolToFloat(stream.Stats.Alive),
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamGaugeMetric(
+		streamInputErrorRateDesc,
+		stream.Stats.InputErrorRate,
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamGaugeMetric(
+		streamTracksCountDesc,
+		float64(len(stream.Stats.MediaInfo.Tracks)),
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamGaugeMetric(
+		streamDisabledDesc,
+		boolToFloat(stream.Options.Disabled),
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamGaugeMetric(
+		streamStaticDesc,
+		boolToFloat(stream.Options.Static),
+		instanceName,
+		stream,
+	))
+	//flussonic reports lifetime in milliseconds
+	cache.addMetric(newStreamGaugeMetric(
+		streamLifetimeDesc,
+		stream.Stats.Lifetime/1000,
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamGaugeMetric(
+		streamClientCountDesc,
+		stream.Stats.ClientCount,
+		instanceName,
+		stream,
+	))
+	cache.addMetric(prometheus.MustNewConstMetric(
+		streamInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		instanceName,
+		stream.Name,
+		stream.Stats.MediaInfo.Provider,
+		stream.Stats.MediaInfo.Title,
+	))
+	for _, track := range stream.Stats.MediaInfo.Tracks {
+		addTrackMetrics(cache, instanceName, stream, track)
+	}
+	if stream.Stats.Url != "" {
+		addSourceMetrics(cache, instanceName, stream)
+	}
+	addPushMetrics(cache, instanceName, stream)
+}
+
+func addSourceMetrics(cache *flussonicCollectorCache, instanceName string, stream *flussonic.Stream) {
+	host, protocol := stream.Stats.Source()
+	cache.addMetric(prometheus.MustNewConstMetric(
+		streamInputBytesTotalDesc,
+		prometheus.CounterValue,
+		stream.Stats.InputBytes,
+		instanceName,
+		stream.Name,
+		host,
+	))
+	cache.addMetric(prometheus.MustNewConstMetric(
+		streamTsDelayDesc,
+		prometheus.GaugeValue,
+		stream.Stats.TsDelay,
+		instanceName,
+		stream.Name,
+		host,
+	))
+	cache.addMetric(prometheus.MustNewConstMetric(
+		streamSourceSwitchesDesc,
+		prometheus.CounterValue,
+		stream.Stats.SourceSwitches,
+		instanceName,
+		stream.Name,
+		host,
+	))
+	cache.addMetric(prometheus.MustNewConstMetric(
+		streamSourceInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		instanceName,
+		stream.Name,
+		host,
+		protocol,
+	))
+}
+
+// addPushMetrics adds push metrics summed by push host, as a stream may push to several urls of one host
+// (e.g. different stream keys) and url path is not exported.
+func addPushMetrics(cache *flussonicCollectorCache, instanceName string, stream *flussonic.Stream) {
+	type pushStats struct {
+		up      float64
+		retries float64
+		bytes   float64
+		errors  float64
+	}
+	hosts := make(map[string]*pushStats)
+	for _, push := range stream.Stats.Push {
+		host := push.Host()
+		stats, ok := hosts[host]
+		if !ok {
+			stats = &pushStats{up: 1}
+			hosts[host] = stats
+		}
+		if !push.IsRunning() {
+			stats.up = 0
+		}
+		stats.retries += push.Retries
+		stats.bytes += push.Bytes
+		stats.errors += push.Errors
+	}
+	for host, stats := range hosts {
+		for _, m := range []struct {
+			desc      *prometheus.Desc
+			valueType prometheus.ValueType
+			value     float64
+		}{
+			{streamPushUpDesc, prometheus.GaugeValue, stats.up},
+			{streamPushRetriesDesc, prometheus.CounterValue, stats.retries},
+			{streamPushBytesDesc, prometheus.CounterValue, stats.bytes},
+			{streamPushErrorsDesc, prometheus.CounterValue, stats.errors},
+		} {
+			cache.addMetric(prometheus.MustNewConstMetric(
+				m.desc,
+				m.valueType,
+				m.value,
+				instanceName,
+				stream.Name,
+				host,
+			))
+		}
+	}
+}
+
+func addDvrMetrics(cache *flussonicCollectorCache, instanceName string, stream *flussonic.Stream, status *flussonic.DvrStatus) {
+	for _, m := range []struct {
+		desc  *prometheus.Desc
+		value float64
+	}{
+		{streamDvrDepthDesc, status.Depth},
+		{streamDvrBytesDesc, status.Bytes},
+		{streamDvrEndDesc, status.To},
+		{streamDvrLastGapDesc, status.LastGap()},
+	} {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			m.desc,
+			prometheus.GaugeValue,
+			m.value,
+			instanceName,
+			stream.Name,
+		))
+	}
+}
+
+func addTrackMetrics(cache *flussonicCollectorCache, instanceName string, stream *flussonic.Stream, track flussonic.Tracks) {
+	cache.addMetric(prometheus.MustNewConstMetric(
+		streamTrackInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		instanceName,
+		stream.Name,
+		track.TrackId,
+		track.Content,
+		track.Codec,
+		formatNonZero(track.Width),
+		formatNonZero(track.Height),
+		track.Lang,
+	))
+	cache.addMetric(newTrackGaugeMetric(streamTrackBitrateDesc, track.Bitrate, instanceName, stream, track))
+	switch track.Content {
+	case "video":
+		cache.addMetric(newTrackGaugeMetric(streamTrackFpsDesc, track.Fps, instanceName, stream, track))
+	case "audio":
+		cache.addMetric(newTrackGaugeMetric(streamTrackSampleRateDesc, track.SampleRate, instanceName, stream, track))
+		cache.addMetric(newTrackGaugeMetric(streamTrackChannelsDesc, track.Channels, instanceName, stream, track))
+	}
+}
+
+func newTrackGaugeMetric(desc *prometheus.Desc, value float64, instanceName string, stream *flussonic.Stream, track flussonic.Tracks) prometheus.Metric {
+	return prometheus.MustNewConstMetric(
+		desc,
+		prometheus.GaugeValue,
+		value,
+		instanceName,
+		stream.Name,
+		track.TrackId,
+		track.Content,
+	)
+}
+
+// topN returns n biggest counts, the rest are summed as "other" to keep label cardinality bounded.
+func topN(counts map[string]float64, n int) map[string]float64 {
+	if len(counts) <= n {
+		return counts
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] == counts[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return counts[keys[i]] > counts[keys[j]]
+	})
+	top := make(map[string]float64, n+1)
+	for i, key := range keys {
+		if i < n {
+			top[key] += counts[key]
+		} else {
+			top["other"] += counts[key]
+		}
+	}
+	return top
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// formatNonZero formats number for label value, zero means absent value and gives empty label.
+func formatNonZero(value float64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func addStreamClientsMetrics(cache *flussonicCollectorCache, instanceName string, stream *flussonic.Stream, sessions *flussonic.Sessions) {
+	session, ok := sessions.Sessions[stream.Name]
+	if !ok {
+		session = &flussonic.MediaSessions{
+			Name:         stream.Name,
+			DvrClients:   0,
+			TotalClients: 0,
+			Types:        nil,
+		}
+	}
+	cache.addMetric(newStreamGaugeMetric(
+		streamClientsTotalDesc,
+		session.TotalClients,
+		instanceName,
+		stream,
+	))
+	cache.addMetric(newStreamGaugeMetric(
+		streamClientsDvrDesc,
+		session.DvrClients,
+		instanceName,
+		stream,
+	))
+	for sessionType, count := range session.Types {
+		cache.addMetric(prometheus.MustNewConstMetric(
+			streamClientsByProtocolDesc,
+			prometheus.GaugeValue,
+			count,
+			instanceName,
+			stream.Name,
+			sessionType,
+		))
+	}
+	uniqueIps := float64(0)
+	if session.UniqueIps != nil {
+		uniqueIps = session.UniqueIps.Estimate()
+	}
+	cache.addMetric(prometheus.MustNewConstMetric(
+		streamUniqueIpsDesc,
+		prometheus.GaugeValue,
+		uniqueIps,
+		instanceName,
+		stream.Name,
+	))
+	if session.Durations != nil {
+		cache.addMetric(prometheus.MustNewConstHistogram(
+			streamSessionDurationDesc,
+			session.Durations.Count,
+			session.Durations.Sum,
+			session.Durations.Buckets(),
+			instanceName,
+			stream.Name,
+		))
+	}
+	if session.Bytes != nil {
+		cache.addMetric(prometheus.MustNewConstHistogram(
+			streamSessionBytesDesc,
+			session.Bytes.Count,
+			session.Bytes.Sum,
+			session.Bytes.Buckets(),
+			instanceName,
+			stream.Name,
+		))
+	}
+}
+
 func newStreamMetric(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, instanceName string, stream *flussonic.Stream) prometheus.Metric {
 	dvrEnabled := "0"
 	if stream.Stats.DvrEnabled {
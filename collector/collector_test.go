@@ -0,0 +1,193 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package collector
+
+import (
+	"github.com/mef13/flussonic_exporter/flussonic"
+	"github.com/mef13/flussonic_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testResponses are legacy api responses of flussonic with one stream, which has archive, push and tracks.
+var testResponses = map[string]string{
+	"/flussonic/api/server": `{"total_clients":3,"cpu_usage":12,"memory_usage":40,"total_memory":8000000000,
+		"uptime":3600,"version":"20.10","build":123,"hostname":"fl1","scheduler_load":0.5,
+		"input_kbit":4000,"output_kbit":12000,"license_valid":true}`,
+	"/flussonic/api/media": `[{"entry":"stream","value":{"name":"a","options":{"title":"A","static":true},
+		"stats":{"alive":true,"bitrate":4000,"dvr_enabled":true,"url":"udp://239.0.0.1:1234","input_bytes":1000,
+			"push":[{"url":"rtmp://cdn/live/key","status":"running","retries":1,"bytes":500}],
+			"media_info":{"tracks":[{"track_id":"v1","content":"video","codec":"h264","width":1920,"height":1080,"fps":25},
+				{"track_id":"a1","content":"audio","codec":"aac","sample_rate":48000,"channels":2,"lang":"eng"}]}}}}]`,
+	"/flussonic/api/sessions": `{"sessions":[
+		{"name":"a","type":"hls","ip":"10.0.0.1","user_agent":"VLC/3.0","bytes":5000000,"opened_at":1600000000000,"country":"RU"},
+		{"name":"a","type":"dvr_hls","ip":"10.0.0.2","user_agent":"Mozilla/5.0 Chrome/86"}]}`,
+	"/flussonic/api/dvr_status/a": `{"from":1600000000,"to":1600003600,"bytes":1000000,
+		"ranges":[{"from":1600000000,"duration":1000},{"from":1600002000,"duration":1600}]}`,
+	"/flussonic/api/disks": `{"disks":[{"path":"/storage","total_bytes":1000,"used_bytes":500,"status":"ok"}]}`,
+}
+
+func TestMain(m *testing.M) {
+	logPath, err := ioutil.TempDir("", "flussonic_exporter")
+	if err != nil {
+		panic(err)
+	}
+	logger.InitLogger(logPath, "fatal", "", "test")
+	code := m.Run()
+	os.RemoveAll(logPath)
+	os.Exit(code)
+}
+
+// newTestServer serves testResponses, other paths are not found.
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := testResponses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+// newTestFlussonic parses config of flussonic at url, options are added to its config entry.
+func newTestFlussonic(t *testing.T, url string, options map[string]interface{}) flussonic.Flussonic {
+	conf := map[string]interface{}{"url": url}
+	for key, value := range options {
+		conf[key] = value
+	}
+	v := viper.New()
+	v.Set("flussonics", []interface{}{conf})
+	fluss, err := flussonic.ParseConfig(v, "flussonics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *fluss[0]
+}
+
+func gather(t *testing.T, c prometheus.Collector) {
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestScrapeAndCollect checks that cache is safe to collect while it's saved, run it with -race.
+func TestScrapeAndCollect(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	flus := newTestFlussonic(t, server.URL, nil)
+	c := NewCollector()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.Scrape(flus)
+		}()
+		go func() {
+			defer wg.Done()
+			gather(t, c)
+		}()
+	}
+	wg.Wait()
+}
+
+// TestDescribedMetrics checks that every collected metric is described, with every optional endpoint enabled.
+func TestDescribedMetrics(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	flus := newTestFlussonic(t, server.URL, map[string]interface{}{
+		"instance-name":   "test",
+		"dvr-metrics":     true,
+		"disk-metrics":    true,
+		"session-details": true,
+	})
+	c := NewCollector()
+	c.Scrape(flus)
+
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	//optional endpoints were scraped
+	expected := `
+# HELP flussonic_disk_used_bytes flussonic_exporter: Disk used space.
+# TYPE flussonic_disk_used_bytes gauge
+flussonic_disk_used_bytes{path="/storage",raid="",server="test"} 500
+# HELP flussonic_stream_dvr_depth_seconds flussonic_exporter: Stream archive depth.
+# TYPE flussonic_stream_dvr_depth_seconds gauge
+flussonic_stream_dvr_depth_seconds{name="a",server="test"} 3600
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"flussonic_disk_used_bytes", "flussonic_stream_dvr_depth_seconds")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestServerMissingStats checks that stats missing in server response are not exported as 0.
+func TestServerMissingStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/flussonic/api/server" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"total_clients":1,"cpu_usage":0,"version":"20.10"}`))
+	}))
+	defer server.Close()
+	c := NewCollector()
+	c.Scrape(newTestFlussonic(t, server.URL, map[string]interface{}{"instance-name": "test"}))
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	collected := make(map[string]bool)
+	for _, family := range families {
+		collected[family.GetName()] = true
+	}
+	if !collected["flussonic_server_cpu_usage"] {
+		t.Error("reported cpu_usage 0 is not collected")
+	}
+	for _, name := range []string{"flussonic_server_license_valid", "flussonic_server_uptime_seconds",
+		"flussonic_server_memory_bytes"} {
+		if collected[name] {
+			t.Errorf("%s is collected, but it's missing in server response", name)
+		}
+	}
+}
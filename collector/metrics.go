@@ -0,0 +1,459 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "flussonic"
+
+var (
+	scrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `scrape`, `collector_duration_seconds`),
+		`flussonic_exporter: Duration of a collector scrape.`,
+		[]string{`server`},
+		nil,
+	)
+	scrapeSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `scrape`, `collector_success`),
+		`flussonic_exporter: Whether a collector succeeded.`,
+		[]string{`server`},
+		nil,
+	)
+	scrapeEndpointSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `scrape`, `endpoint_success`),
+		`flussonic_exporter: Whether a flussonic api endpoint request succeeded.`,
+		[]string{`server`, `endpoint`},
+		nil,
+	)
+	scrapeLastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `scrape`, `last_success_timestamp_seconds`),
+		`flussonic_exporter: Unix time of the last successful scrape.`,
+		[]string{`server`},
+		nil,
+	)
+	scrapeCacheAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `scrape`, `cache_age_seconds`),
+		`flussonic_exporter: Age of cached scrape results.`,
+		[]string{`server`},
+		nil,
+	)
+	scrapeFailureDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `scrape`, `collector_failure`),
+		`flussonic_exporter: Reason of the first failed endpoint request in the last scrape (timeout, canceled, refused or error).`,
+		[]string{`server`, `reason`},
+		nil,
+	)
+
+	totalClientsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `clients`, `total`),
+		`flussonic_exporter: Total clients count.`,
+		[]string{`server`},
+		prometheus.Labels{"type": "total"},
+	)
+	totalDvrClientsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `clients`, `total`),
+		`flussonic_exporter: Total clients count.`,
+		[]string{`server`},
+		prometheus.Labels{"type": "dvr"},
+	)
+	clientsByProtocolDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `clients`, `by_protocol`),
+		`flussonic_exporter: Clients count by session type.`,
+		[]string{`server`, `type`},
+		nil,
+	)
+	uniqueIpsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, ``, `unique_ips`),
+		`flussonic_exporter: Estimated count of distinct client ips.`,
+		[]string{`server`},
+		nil,
+	)
+	clientsByUserAgentDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `clients`, `by_user_agent`),
+		`flussonic_exporter: Clients count by user agent family, top families only.`,
+		[]string{`server`, `family`},
+		nil,
+	)
+	clientsByCountryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `clients`, `by_country`),
+		`flussonic_exporter: Clients count by country, top countries only.`,
+		[]string{`server`, `country`},
+		nil,
+	)
+	serverCpuUsageDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `cpu_usage`),
+		`flussonic_exporter: Server CPU usage in percent.`,
+		[]string{`server`},
+		nil,
+	)
+	serverMemoryTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `memory_bytes`),
+		`flussonic_exporter: Server memory.`,
+		[]string{`server`},
+		prometheus.Labels{"type": "total"},
+	)
+	serverMemoryUsedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `memory_bytes`),
+		`flussonic_exporter: Server memory.`,
+		[]string{`server`},
+		prometheus.Labels{"type": "used"},
+	)
+	serverUptimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `uptime_seconds`),
+		`flussonic_exporter: Server uptime.`,
+		[]string{`server`},
+		nil,
+	)
+	serverSchedulerLoadDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `scheduler_load`),
+		`flussonic_exporter: Server scheduler load.`,
+		[]string{`server`},
+		nil,
+	)
+	serverInputBitrateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `input_bitrate`),
+		`flussonic_exporter: Server total input bitrate.`,
+		[]string{`server`},
+		nil,
+	)
+	serverOutputBitrateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `output_bitrate`),
+		`flussonic_exporter: Server total output bitrate.`,
+		[]string{`server`},
+		nil,
+	)
+	serverLicenseValidDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `license_valid`),
+		`flussonic_exporter: Is server license valid.`,
+		[]string{`server`},
+		nil,
+	)
+	serverInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `server`, `info`),
+		`flussonic_exporter: Server version info.`,
+		[]string{`server`, `version`, `build`, `hostname`},
+		nil,
+	)
+	diskLabels         = []string{`server`, `path`, `raid`}
+	diskTotalBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `disk`, `total_bytes`),
+		`flussonic_exporter: Disk size.`,
+		diskLabels,
+		nil,
+	)
+	diskUsedBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `disk`, `used_bytes`),
+		`flussonic_exporter: Disk used space.`,
+		diskLabels,
+		nil,
+	)
+	diskStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `disk`, `status`),
+		`flussonic_exporter: Is disk healthy, status label holds flussonic disk status.`,
+		[]string{`server`, `path`, `raid`, `status`},
+		nil,
+	)
+	diskReadErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `disk`, `read_errors_total`),
+		`flussonic_exporter: Disk read errors count.`,
+		diskLabels,
+		nil,
+	)
+	diskWriteErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `disk`, `write_errors_total`),
+		`flussonic_exporter: Disk write errors count.`,
+		diskLabels,
+		nil,
+	)
+	requestDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `scrape`, `api_request_duration_sec`),
+		`flussonic_exporter: API request duration.`,
+		[]string{`server`, `url`},
+		nil,
+	)
+
+	streamLabels      = []string{`server`, `name`, `title`, `comment`, `dvr_enabled`, `transcoder_enabled`}
+	streamBitrateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `bitrate`),
+		`flussonic_exporter: Stream bitrate.`,
+		streamLabels,
+		nil,
+	)
+	streamRetryCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `retry_count`),
+		`flussonic_exporter: Stream retry count.`,
+		streamLabels,
+		nil,
+	)
+	streamAliveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `is_alive`),
+		`flussonic_exporter: Is stream alive.`,
+		streamLabels,
+		nil,
+	)
+	streamInputErrorRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `input_error_rate`),
+		`flussonic_exporter: Stream input error rate.`,
+		streamLabels,
+		nil,
+	)
+	streamTracksCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `tracks_count`),
+		`flussonic_exporter: Stream tracks count.`,
+		streamLabels,
+		nil,
+	)
+	streamClientsTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `clients_count`),
+		`flussonic_exporter: Stream clients count.`,
+		streamLabels,
+		prometheus.Labels{"type": "total"},
+	)
+	streamClientsDvrDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `clients_count`),
+		`flussonic_exporter: Stream clients count.`,
+		streamLabels,
+		prometheus.Labels{"type": "dvr"},
+	)
+	streamClientsByProtocolDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `clients_by_protocol`),
+		`flussonic_exporter: Stream clients count by session type.`,
+		[]string{`server`, `name`, `type`},
+		nil,
+	)
+	streamUniqueIpsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `unique_ips`),
+		`flussonic_exporter: Estimated count of distinct stream client ips.`,
+		[]string{`server`, `name`},
+		nil,
+	)
+	streamSessionDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `session_duration_seconds`),
+		`flussonic_exporter: Duration of stream sessions open at scrape time.`,
+		[]string{`server`, `name`},
+		nil,
+	)
+	streamSessionBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `session_bytes`),
+		`flussonic_exporter: Bytes delivered by stream sessions open at scrape time.`,
+		[]string{`server`, `name`},
+		nil,
+	)
+	streamLifetimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `lifetime_seconds`),
+		`flussonic_exporter: Stream uptime since the last restart.`,
+		streamLabels,
+		nil,
+	)
+	streamClientCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `client_count`),
+		`flussonic_exporter: Stream clients count reported by flussonic.`,
+		streamLabels,
+		nil,
+	)
+	streamInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `info`),
+		`flussonic_exporter: Stream media info.`,
+		[]string{`server`, `name`, `provider`, `media_title`},
+		nil,
+	)
+	streamDisabledDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `disabled`),
+		`flussonic_exporter: Is stream disabled in flussonic config.`,
+		streamLabels,
+		nil,
+	)
+	streamStaticDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `static`),
+		`flussonic_exporter: Is stream static (1) or ondemand (0).`,
+		streamLabels,
+		nil,
+	)
+	sourceLabels              = []string{`server`, `name`, `url_host`}
+	streamInputBytesTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `input_bytes_total`),
+		`flussonic_exporter: Bytes received from stream source.`,
+		sourceLabels,
+		nil,
+	)
+	streamTsDelayDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `ts_delay_ms`),
+		`flussonic_exporter: Time since the last frame received from stream source.`,
+		sourceLabels,
+		nil,
+	)
+	streamSourceSwitchesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `source_switches_total`),
+		`flussonic_exporter: Stream source switches count.`,
+		sourceLabels,
+		nil,
+	)
+	streamSourceInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `source_info`),
+		`flussonic_exporter: Stream current source.`,
+		[]string{`server`, `name`, `url_host`, `protocol`},
+		nil,
+	)
+	pushLabels       = []string{`server`, `name`, `push_url_host`}
+	streamPushUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `push_up`),
+		`flussonic_exporter: Whether all stream pushes to the host are running.`,
+		pushLabels,
+		nil,
+	)
+	streamPushRetriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `push_retries_total`),
+		`flussonic_exporter: Stream push retries count.`,
+		pushLabels,
+		nil,
+	)
+	streamPushBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `push_bytes_total`),
+		`flussonic_exporter: Bytes sent by stream push.`,
+		pushLabels,
+		nil,
+	)
+	streamPushErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `push_errors_total`),
+		`flussonic_exporter: Stream push errors count.`,
+		pushLabels,
+		nil,
+	)
+	dvrLabels          = []string{`server`, `name`}
+	streamDvrDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `dvr_depth_seconds`),
+		`flussonic_exporter: Stream archive depth.`,
+		dvrLabels,
+		nil,
+	)
+	streamDvrBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `dvr_bytes`),
+		`flussonic_exporter: Stream archive size.`,
+		dvrLabels,
+		nil,
+	)
+	streamDvrEndDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `dvr_end_timestamp`),
+		`flussonic_exporter: Unix time of the archive end, stops growing when recording stalls.`,
+		dvrLabels,
+		nil,
+	)
+	streamDvrLastGapDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `dvr_last_gap_timestamp`),
+		`flussonic_exporter: Unix time when the latest archive gap started, 0 if there are no gaps.`,
+		dvrLabels,
+		nil,
+	)
+	trackLabels         = []string{`server`, `name`, `track_id`, `content`}
+	streamTrackInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `track_info`),
+		`flussonic_exporter: Stream track media info.`,
+		[]string{`server`, `name`, `track_id`, `content`, `codec`, `width`, `height`, `lang`},
+		nil,
+	)
+	streamTrackBitrateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `track_bitrate`),
+		`flussonic_exporter: Stream track bitrate.`,
+		trackLabels,
+		nil,
+	)
+	streamTrackFpsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `track_fps`),
+		`flussonic_exporter: Stream video track frame rate.`,
+		trackLabels,
+		nil,
+	)
+	streamTrackSampleRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `track_sample_rate`),
+		`flussonic_exporter: Stream audio track sample rate.`,
+		trackLabels,
+		nil,
+	)
+	streamTrackChannelsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, `stream`, `track_channels`),
+		`flussonic_exporter: Stream audio track channels count.`,
+		trackLabels,
+		nil,
+	)
+
+	// descs lists every descriptor emitted by the collector. New descriptors must be added here.
+	descs = []*prometheus.Desc{
+		scrapeDurationDesc,
+		scrapeSuccessDesc,
+		scrapeEndpointSuccessDesc,
+		scrapeLastSuccessDesc,
+		scrapeCacheAgeDesc,
+		scrapeFailureDesc,
+		totalClientsDesc,
+		totalDvrClientsDesc,
+		clientsByProtocolDesc,
+		uniqueIpsDesc,
+		clientsByUserAgentDesc,
+		clientsByCountryDesc,
+		serverCpuUsageDesc,
+		serverMemoryTotalDesc,
+		serverMemoryUsedDesc,
+		serverUptimeDesc,
+		serverSchedulerLoadDesc,
+		serverInputBitrateDesc,
+		serverOutputBitrateDesc,
+		serverLicenseValidDesc,
+		serverInfoDesc,
+		diskTotalBytesDesc,
+		diskUsedBytesDesc,
+		diskStatusDesc,
+		diskReadErrorsDesc,
+		diskWriteErrorsDesc,
+		requestDurationDesc,
+		streamBitrateDesc,
+		streamRetryCountDesc,
+		streamAliveDesc,
+		streamInputErrorRateDesc,
+		streamTracksCountDesc,
+		streamClientsTotalDesc,
+		streamClientsDvrDesc,
+		streamClientsByProtocolDesc,
+		streamUniqueIpsDesc,
+		streamSessionDurationDesc,
+		streamSessionBytesDesc,
+		streamLifetimeDesc,
+		streamClientCountDesc,
+		streamInfoDesc,
+		streamDisabledDesc,
+		streamStaticDesc,
+		streamInputBytesTotalDesc,
+		streamTsDelayDesc,
+		streamSourceSwitchesDesc,
+		streamSourceInfoDesc,
+		streamPushUpDesc,
+		streamPushRetriesDesc,
+		streamPushBytesDesc,
+		streamPushErrorsDesc,
+		streamDvrDepthDesc,
+		streamDvrBytesDesc,
+		streamDvrEndDesc,
+		streamDvrLastGapDesc,
+		streamTrackInfoDesc,
+		streamTrackBitrateDesc,
+		streamTrackFpsDesc,
+		streamTrackSampleRateDesc,
+		streamTrackChannelsDesc,
+	}
+)
@@ -0,0 +1,103 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package collector
+
+import (
+	"context"
+	"github.com/mef13/flussonic_exporter/flussonic"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SetTargets sets flussonic instances scraped by Refresh.
+func (c *FlussonicCollector) SetTargets(fluss []*flussonic.Flussonic) {
+	targets := make([]flussonic.Flussonic, 0, len(fluss))
+	for _, flus := range fluss {
+		targets = append(targets, *flus)
+	}
+	c.targetsSync.Lock()
+	defer c.targetsSync.Unlock()
+	c.targets = targets
+}
+
+// Refresh scrapes all targets in parallel and waits until they are saved or ctx is done.
+// Concurrent calls share in-flight scrapes of the same target.
+func (c *FlussonicCollector) Refresh(ctx context.Context) {
+	for _, done := range c.startRefresh() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startRefresh starts scrape of every target which isn't scraped yet and returns channels closed when
+// scrapes of all targets are done. Targets are deduplicated one by one, so a slow target doesn't delay
+// scrapes of the others. Scrapes aren't bound to ctx of any caller, so a caller with short timeout
+// doesn't cancel them for the others, every scrape is limited by scrape interval of its instance.
+func (c *FlussonicCollector) startRefresh() []<-chan struct{} {
+	c.targetsSync.RLock()
+	targets := c.targets
+	c.targetsSync.RUnlock()
+
+	c.refreshSync.Lock()
+	defer c.refreshSync.Unlock()
+	if c.refreshing == nil {
+		c.refreshing = make(map[string]chan struct{})
+	}
+	dones := make([]<-chan struct{}, 0, len(targets))
+	for _, target := range targets {
+		key := target.Url.String()
+		done, ok := c.refreshing[key]
+		if !ok {
+			done = make(chan struct{})
+			c.refreshing[key] = done
+			go func(flussConf flussonic.Flussonic, done chan struct{}) {
+				c.scrape(context.Background(), flussConf)
+
+				c.refreshSync.Lock()
+				delete(c.refreshing, key)
+				c.refreshSync.Unlock()
+				close(done)
+			}(target, done)
+		}
+		dones = append(dones, done)
+	}
+	return dones
+}
+
+type onDemandCollector struct {
+	ctx       context.Context
+	collector *FlussonicCollector
+}
+
+// OnDemand returns a collector that refreshes all targets within ctx on every Collect.
+func (c *FlussonicCollector) OnDemand(ctx context.Context) prometheus.Collector {
+	return onDemandCollector{ctx: ctx, collector: c}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c onDemandCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c onDemandCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collector.Refresh(c.ctx)
+	c.collector.Collect(ch)
+}
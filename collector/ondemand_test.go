@@ -0,0 +1,107 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package collector
+
+import (
+	"context"
+	"github.com/mef13/flussonic_exporter/flussonic"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRefreshSharedByCallers checks that caller which gives up early doesn't cancel refresh for the others.
+func TestRefreshSharedByCallers(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+
+	flus := newTestFlussonic(t, slow.URL, nil)
+	c := NewCollector()
+	c.SetTargets([]*flussonic.Flussonic{&flus})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		c.Refresh(ctx)
+	}()
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	c.Refresh(context.Background())
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "flussonic_scrape_collector_success" {
+			continue
+		}
+		if value := family.GetMetric()[0].GetGauge().GetValue(); value != 1 {
+			t.Errorf("collector_success = %v, want 1", value)
+		}
+		return
+	}
+	t.Error("collector_success is not collected")
+}
+
+// TestRefreshSlowTarget checks that target still scraped by previous refresh doesn't delay scrapes of the others.
+func TestRefreshSlowTarget(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+	defer close(release)
+	var fastScrapes int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flussonic/api/server" {
+			atomic.AddInt32(&fastScrapes, 1)
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer fast.Close()
+
+	slowFlus := newTestFlussonic(t, slow.URL, map[string]interface{}{"instance-name": "slow"})
+	fastFlus := newTestFlussonic(t, fast.URL, map[string]interface{}{"instance-name": "fast"})
+	c := NewCollector()
+	c.SetTargets([]*flussonic.Flussonic{&slowFlus, &fastFlus})
+
+	for i := int32(1); i <= 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		c.Refresh(ctx)
+		cancel()
+		if scrapes := atomic.LoadInt32(&fastScrapes); scrapes != i {
+			t.Fatalf("fast target is scraped %d times after %d refreshes", scrapes, i)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package collector
+
+import (
+	"context"
+	"github.com/mef13/flussonic_exporter/flussonic"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type probeCollector struct {
+	ctx       context.Context
+	flussConf flussonic.Flussonic
+}
+
+// NewProbe returns a collector that scrapes single flussonic within ctx on Collect.
+func NewProbe(ctx context.Context, flussConf flussonic.Flussonic) prometheus.Collector {
+	return probeCollector{ctx: ctx, flussConf: flussConf}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (p probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	NewCollector().Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (p probeCollector) Collect(ch chan<- prometheus.Metric) {
+	c := NewCollector()
+	c.scrape(p.ctx, p.flussConf)
+	c.Collect(ch)
+}
@@ -0,0 +1,89 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/mef13/flussonic_exporter/flussonic"
+	"github.com/spf13/viper"
+	"sort"
+	"strings"
+)
+
+// knownKeys are top-level config keys, viper keeps them lowercased.
+var knownKeys = map[string]bool{
+	"log-path":         true,
+	"log-level":        true,
+	"sentrydsn":        true,
+	"listen-address":   true,
+	"metrics-path":     true,
+	"exporter-metrics": true,
+	"scrape-mode":      true,
+	"probe-path":       true,
+	"watch-config":     true,
+	"flussonics":       true,
+	"modules":          true,
+}
+
+// parseConfig validates config read by viper and parses flussonics and modules.
+// All problems found are returned together as flussonic.ConfigErrors.
+func parseConfig(v *viper.Viper) ([]*flussonic.Flussonic, map[string]*flussonic.Module, error) {
+	var errs flussonic.ConfigErrors
+	unknown := make(map[string]bool)
+	for _, key := range v.AllKeys() {
+		topKey := strings.SplitN(key, ".", 2)[0]
+		if !knownKeys[topKey] {
+			unknown[topKey] = true
+		}
+	}
+	unknownKeys := make([]string, 0, len(unknown))
+	for key := range unknown {
+		unknownKeys = append(unknownKeys, key)
+	}
+	sort.Strings(unknownKeys)
+	for _, key := range unknownKeys {
+		errs = append(errs, fmt.Errorf("unknown key %q", key))
+	}
+
+	scrapeMode := v.GetString("scrape-mode")
+	if scrapeMode != scrapeModeCron && scrapeMode != scrapeModeOnDemand {
+		errs = append(errs, fmt.Errorf("scrape-mode: must be %s or %s, got %q", scrapeModeCron, scrapeModeOnDemand, scrapeMode))
+	}
+
+	fluss, err := flussonic.ParseConfig(v, "flussonics")
+	errs = errs.Append(err)
+	//flussonics may be omitted if they are only probed, modules configure probing
+	if err == nil && len(fluss) == 0 && !v.IsSet("modules") {
+		errs = append(errs, fmt.Errorf("flussonics: configuration not found, set flussonics or modules"))
+	}
+	modules, err := flussonic.ParseModules(v, "modules")
+	errs = errs.Append(err)
+	if err := errs.Err(); err != nil {
+		return nil, nil, err
+	}
+	return fluss, modules, nil
+}
+
+// checkConfig reads and validates config file, it's used by check-config command to validate config without starting.
+func checkConfig(confPath string) error {
+	if err := initViper(confPath); err != nil {
+		return err
+	}
+	_, _, err := parseConfig(viper.GetViper())
+	return err
+}
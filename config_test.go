@@ -0,0 +1,49 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestParseConfigOnlyModules(t *testing.T) {
+	v := viper.New()
+	v.Set("scrape-mode", scrapeModeOnDemand)
+	v.Set("modules", map[string]interface{}{
+		"edge": map[string]interface{}{"user": "api_user", "password": "pass"},
+	})
+	fluss, modules, err := parseConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fluss) != 0 {
+		t.Errorf("flussonics = %d, want 0", len(fluss))
+	}
+	if _, ok := modules["edge"]; !ok {
+		t.Error("module edge is missing")
+	}
+}
+
+func TestParseConfigEmpty(t *testing.T) {
+	v := viper.New()
+	v.Set("scrape-mode", scrapeModeCron)
+	if _, _, err := parseConfig(v); err == nil {
+		t.Error("error is expected for config without flussonics and modules")
+	}
+}
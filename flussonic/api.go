@@ -0,0 +1,121 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mef13/flussonic_exporter/logger"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Flussonic api versions.
+const (
+	// ApiLegacy is /flussonic/api, deprecated in new flussonic releases.
+	ApiLegacy = "legacy"
+	// ApiV3 is /streamer/api/v3 with cursor pagination.
+	ApiV3 = "v3"
+	// ApiAuto probes which api flussonic supports.
+	ApiAuto = "auto"
+)
+
+const v3StreamsPath = "/streamer/api/v3/streams"
+
+// resolvedApi holds api version found by probing. It's shared by copies of Flussonic, so probe runs once.
+type resolvedApi struct {
+	sync    sync.Mutex
+	version string
+}
+
+func parseApi(value string) (string, error) {
+	switch value {
+	case "":
+		return ApiLegacy, nil
+	case ApiLegacy, ApiV3, ApiAuto:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown api %q, must be %s, %s or %s", value, ApiLegacy, ApiV3, ApiAuto)
+}
+
+// apiVersion returns api used for requests. In auto mode flussonic is probed until probe gets an answer.
+func (f *Flussonic) apiVersion(ctx context.Context) (string, error) {
+	if f.Api != ApiAuto {
+		return f.Api, nil
+	}
+	resolved := f.resolved
+	if resolved == nil {
+		resolved = &resolvedApi{}
+	}
+	resolved.sync.Lock()
+	defer resolved.sync.Unlock()
+	if resolved.version != "" {
+		return resolved.version, nil
+	}
+
+	resp, _, err := f.get(ctx, v3StreamsPath+"?limit=1")
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		resp.Body.Close()
+		resolved.version = ApiV3
+	case errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound:
+		resolved.version = ApiLegacy
+	default:
+		return "", fmt.Errorf("error probing api version: %w", err)
+	}
+	logger.Info("flussonic api version detected", zap.String("server", f.Url.String()),
+		zap.String("api", resolved.version))
+	return resolved.version, nil
+}
+
+// getV3Pages requests all pages of v3 collection. decode reads page body and returns cursor of the next page,
+// empty cursor ends pagination, cursor returned twice is an error. Returns time spent waiting for responses.
+func (f *Flussonic) getV3Pages(ctx context.Context, path string, decode func(body io.Reader) (string, error)) (float64, error) {
+	total := float64(0)
+	cursor := ""
+	seen := make(map[string]bool)
+	for {
+		pagePath := path
+		if cursor != "" {
+			pagePath += "?cursor=" + url.QueryEscape(cursor)
+		}
+		resp, duration, err := f.get(ctx, pagePath)
+		total += duration
+		if err != nil {
+			return total, err
+		}
+		cursor, err = decode(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return total, err
+		}
+		if cursor == "" {
+			return total, nil
+		}
+		//server returning cursor of already requested page would make pagination endless
+		if seen[cursor] {
+			return total, fmt.Errorf("%s: cursor %q is returned again, pagination loops", path, cursor)
+		}
+		seen[cursor] = true
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newV3TestFlussonic returns flussonic with v3 api, which streams are paginated by next.
+// next maps cursor of page to cursor of the following page, every page has one stream named by its cursor.
+func newV3TestFlussonic(t *testing.T, next map[string]string) (*Flussonic, func()) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != v3StreamsPath {
+			http.NotFound(w, r)
+			return
+		}
+		cursor := r.URL.Query().Get("cursor")
+		_, _ = fmt.Fprintf(w, `{"streams":[{"name":"s%s"}],"next":%q}`, cursor, next[cursor])
+	})
+	return newTestServerFlussonic(t, handler, flussonicConfig{Api: ApiV3})
+}
+
+func TestGetMediaV3Pages(t *testing.T) {
+	flus, closeServer := newV3TestFlussonic(t, map[string]string{"": "c1", "c1": "c2"})
+	defer closeServer()
+
+	media, err := flus.GetMedia(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"s", "sc1", "sc2"} {
+		if _, ok := media.Streams[name]; !ok {
+			t.Errorf("stream %s is missing", name)
+		}
+	}
+}
+
+func TestGetMediaV3PagesLoop(t *testing.T) {
+	flus, closeServer := newV3TestFlussonic(t, map[string]string{"": "c1", "c1": "c2", "c2": "c1"})
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := flus.GetMedia(ctx)
+	if err == nil {
+		t.Fatal("error is expected for looping cursors")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("pagination stopped by timeout: %s", err)
+	}
+}
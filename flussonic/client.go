@@ -0,0 +1,128 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultConnectTimeout = 5 * time.Second
+	defaultReadTimeout    = 30 * time.Second
+	defaultTimeout        = 50 * time.Second
+	defaultUserAgent      = "flussonic_exporter"
+)
+
+// newHTTPClient returns a client with keep-alive pooling and the instance timeouts.
+// ConnectTimeout limits dialing, ReadTimeout limits waiting for response headers
+// and Timeout limits the whole request including reading the body.
+func newHTTPClient(f *Flussonic) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if f.Proxy != nil {
+		proxy = http.ProxyURL(f.Proxy)
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   f.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   f.ConnectTimeout,
+		ResponseHeaderTimeout: f.ReadTimeout,
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   f.Timeout,
+	}
+}
+
+// get requests path on the flussonic api. Returns response and time spent waiting for it.
+// Request is canceled when ctx is done. Caller must close response body.
+func (f *Flussonic) get(ctx context.Context, path string) (*http.Response, float64, error) {
+	client := f.client
+	if client == nil {
+		client = newHTTPClient(f)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", f.Url.String()+path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.SetBasicAuth(f.User, f.Password)
+	req.Header.Set("User-Agent", f.UserAgent)
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	duration := time.Since(startTime).Seconds()
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, duration, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, duration, nil
+}
+
+// StatusError is returned when flussonic api responds with non 200 status.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+// parseDuration parses positive duration, def is returned if value is empty.
+func parseDuration(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("must be positive, got %q", value)
+	}
+	return duration, nil
+}
+
+// parseProxy parses http(s) or socks5 proxy url, nil is returned if value is empty.
+func parseProxy(value string) (*url.URL, error) {
+	if value == "" {
+		return nil, nil
+	}
+	proxy, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	//url without scheme, e.g. proxy:3128, is parsed as scheme proxy without host
+	if proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5" || proxy.Host == "" {
+		return nil, fmt.Errorf("must be http(s) or socks5 url, got %q", value)
+	}
+	return proxy, nil
+}
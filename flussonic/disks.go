@@ -0,0 +1,61 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type Disks struct {
+	RequestDuration float64 `json:"-"`
+	Url             string  `json:"-"`
+	Disks           []Disk  `json:"disks"`
+}
+
+// Disk is a storage volume used by flussonic, e.g. for dvr. Raid is empty if disk is not a raid member.
+type Disk struct {
+	Path        string  `json:"path"`
+	Raid        string  `json:"raid"`
+	TotalBytes  float64 `json:"total_bytes"`
+	UsedBytes   float64 `json:"used_bytes"`
+	Status      string  `json:"status"`
+	ReadErrors  float64 `json:"read_errors"`
+	WriteErrors float64 `json:"write_errors"`
+}
+
+// IsHealthy reports whether disk is available for reading and writing.
+func (d Disk) IsHealthy() bool {
+	return d.Status == "ok"
+}
+
+func (f *Flussonic) GetDisks(ctx context.Context) (*Disks, error) {
+	disks := Disks{}
+	disks.Url = "/flussonic/api/disks"
+	resp, duration, err := f.get(ctx, disks.Url)
+	if err != nil {
+		return nil, err
+	}
+	disks.RequestDuration = duration
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&disks)
+	if err != nil {
+		return nil, err
+	}
+	return &disks, nil
+}
@@ -0,0 +1,78 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestServerFlussonic returns flussonic configured by conf, which api is served by handler.
+func newTestServerFlussonic(t *testing.T, handler http.Handler, conf flussonicConfig) (*Flussonic, func()) {
+	server := httptest.NewServer(handler)
+	conf.Url = server.URL
+	flus, err := conf.newFlussonic()
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return flus, server.Close
+}
+
+// newTestFlussonic returns flussonic of api server serving files from testdata, path is mapped to file by files.
+func newTestFlussonic(t *testing.T, files map[string]string) (*Flussonic, func()) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", file))
+	})
+	return newTestServerFlussonic(t, handler, flussonicConfig{})
+}
+
+func TestGetDisks(t *testing.T) {
+	flus, closeServer := newTestFlussonic(t, map[string]string{"/flussonic/api/disks": "disks.json"})
+	defer closeServer()
+
+	disks, err := flus.GetDisks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Disk{
+		{Path: "/storage/1", Raid: "md0", TotalBytes: 4000787030016, UsedBytes: 3200629624012, Status: "ok"},
+		{Path: "/storage/2", Raid: "md0", TotalBytes: 4000787030016, UsedBytes: 3100000000000, Status: "degraded",
+			ReadErrors: 17, WriteErrors: 3},
+		{Path: "/var/lib/flussonic", TotalBytes: 240057409536, UsedBytes: 12884901888, Status: "ok"},
+	}
+	if !reflect.DeepEqual(disks.Disks, expected) {
+		t.Errorf("disks = %+v, want %+v", disks.Disks, expected)
+	}
+
+	healthy := []bool{true, false, true}
+	for i, disk := range disks.Disks {
+		if disk.IsHealthy() != healthy[i] {
+			t.Errorf("%s: IsHealthy() = %v, want %v", disk.Path, disk.IsHealthy(), healthy[i])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// dvrConcurrency limits parallel dvr status requests to one flussonic.
+const dvrConcurrency = 4
+
+type Dvr struct {
+	RequestDuration float64
+	Url             string
+	Streams         map[string]*DvrStatus
+}
+
+// DvrStatus is a state of stream archive. Times are unix seconds.
+type DvrStatus struct {
+	From   float64    `json:"from"`
+	To     float64    `json:"to"`
+	Depth  float64    `json:"depth"`
+	Bytes  float64    `json:"bytes"`
+	Ranges []DvrRange `json:"ranges"`
+}
+
+// DvrRange is a continuous part of archive.
+type DvrRange struct {
+	From     float64 `json:"from"`
+	Duration float64 `json:"duration"`
+}
+
+// LastGap returns time when the latest gap in archive started, 0 if archive has no gaps.
+func (d *DvrStatus) LastGap() float64 {
+	if len(d.Ranges) < 2 {
+		return 0
+	}
+	prev := d.Ranges[len(d.Ranges)-2]
+	return prev.From + prev.Duration
+}
+
+// GetDvr requests archive status of streams. On errors it returns statuses received so far with the first error.
+func (f *Flussonic) GetDvr(ctx context.Context, names []string) (*Dvr, error) {
+	dvr := Dvr{Streams: make(map[string]*DvrStatus)}
+	dvr.Url = "/flussonic/api/dvr_status"
+	startTime := time.Now()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	queue := make(chan string)
+	for i := 0; i < dvrConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				status, err := f.getDvrStatus(ctx, dvr.Url, name)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("stream %s: %w", name, err)
+					}
+				} else {
+					dvr.Streams[name] = status
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	dvr.RequestDuration = time.Since(startTime).Seconds()
+	return &dvr, firstErr
+}
+
+func (f *Flussonic) getDvrStatus(ctx context.Context, path string, name string) (*DvrStatus, error) {
+	streamPath := (&url.URL{Path: name}).EscapedPath()
+	resp, _, err := f.get(ctx, path+"/"+streamPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	status := DvrStatus{}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return nil, err
+	}
+	if status.Depth == 0 && status.To > status.From {
+		status.Depth = status.To - status.From
+	}
+	return &status, nil
+}
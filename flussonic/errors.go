@@ -0,0 +1,50 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import "strings"
+
+// ConfigErrors holds all problems found in config, so they can be fixed at once.
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Append adds err to e. Errors of nested ConfigErrors are added one by one, nil is skipped.
+func (e ConfigErrors) Append(err error) ConfigErrors {
+	switch err := err.(type) {
+	case nil:
+		return e
+	case ConfigErrors:
+		return append(e, err...)
+	}
+	return append(e, err)
+}
+
+// Err returns nil if there are no errors.
+func (e ConfigErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
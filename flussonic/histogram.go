@@ -0,0 +1,52 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+// Histogram counts observations in buckets, it's filled without keeping observations.
+type Histogram struct {
+	bounds []float64
+	counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *Histogram) observe(value float64) {
+	h.Sum += value
+	h.Count++
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// Buckets returns cumulative counts by bucket upper bound.
+func (h *Histogram) Buckets() map[float64]uint64 {
+	buckets := make(map[float64]uint64, len(h.bounds))
+	cumulative := uint64(0)
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		buckets[bound] = cumulative
+	}
+	return buckets
+}
@@ -0,0 +1,84 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// serverHllPrecision gives 16KB sketch with ~0.8% standard error.
+	serverHllPrecision = 14
+	// streamHllPrecision gives 1KB sketch with ~3.3% standard error, as there can be thousands of streams.
+	streamHllPrecision = 10
+)
+
+// HyperLogLog estimates number of distinct values in constant memory of 2^precision bytes.
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func newHyperLogLog(precision uint8) *HyperLogLog {
+	return &HyperLogLog{precision: precision, registers: make([]uint8, 1<<precision)}
+}
+
+func (h *HyperLogLog) add(value string) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+	index := x >> (64 - h.precision)
+	// sentinel bit limits rank when the rest of hash is zero
+	rest := x<<h.precision | 1<<(h.precision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Estimate returns approximate number of distinct values added.
+func (h *HyperLogLog) Estimate() float64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, register := range h.registers {
+		sum += math.Ldexp(1, -int(register))
+		if register == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		return m * math.Log(m/float64(zeros))
+	}
+	return estimate
+}
+
+// mix64 is murmur3 finalizer, it spreads fnv hash bits which are poorly distributed for short similar strings like ips.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
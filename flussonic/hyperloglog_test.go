@@ -0,0 +1,46 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	for _, precision := range []uint8{streamHllPrecision, serverHllPrecision} {
+		//3 standard errors of estimation
+		tolerance := 3 * 1.04 / math.Sqrt(float64(uint64(1)<<precision))
+		for _, count := range []int{10, 1000, 100000} {
+			h := newHyperLogLog(precision)
+			for i := 0; i < count; i++ {
+				ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+				//repeated sessions of the same ip are counted once
+				h.add(ip)
+				h.add(ip)
+			}
+			estimate := h.Estimate()
+			relErr := math.Abs(estimate-float64(count)) / float64(count)
+			if relErr > tolerance {
+				t.Errorf("precision %d, %d ips: estimate %.0f, error %.4f exceeds %.4f",
+					precision, count, estimate, relErr, tolerance)
+			}
+		}
+	}
+}
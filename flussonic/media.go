@@ -18,10 +18,11 @@
 package flussonic
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/mitchellh/mapstructure"
-	"net/http"
-	"time"
+	"io"
+	"net/url"
 )
 
 type Media struct {
@@ -46,6 +47,23 @@ type Stats struct {
 	RetryCount        float64   `mapstructure:"retry_count"`
 	RunningTranscoder bool      `mapstructure:"running_transcoder"`
 	MediaInfo         MediaInfo `mapstructure:"media_info"`
+	// Url is the current source url, may contain credentials.
+	Url            string  `mapstructure:"url"`
+	SourceSwitches float64 `mapstructure:"source_switches"`
+	LastDts        float64 `mapstructure:"last_dts"`
+	InputBytes     float64 `mapstructure:"input_bytes"`
+	TsDelay        float64 `mapstructure:"ts_delay"`
+	LastAccessAt   float64 `mapstructure:"last_access_at"`
+	Push           []Push  `mapstructure:"push"`
+}
+
+// Push is a status of stream re-publishing to push url.
+type Push struct {
+	Url     string  `mapstructure:"url"`
+	Status  string  `mapstructure:"status"`
+	Retries float64 `mapstructure:"retries"`
+	Bytes   float64 `mapstructure:"bytes"`
+	Errors  float64 `mapstructure:"errors"`
 }
 
 type MediaInfo struct {
@@ -55,31 +73,80 @@ type MediaInfo struct {
 }
 
 type Tracks struct {
-	TrackId string `mapstructure:"track_id"`
-	Content string `mapstructure:"content"`
+	TrackId    string  `mapstructure:"track_id"`
+	Content    string  `mapstructure:"content"`
+	Codec      string  `mapstructure:"codec"`
+	Width      float64 `mapstructure:"width"`
+	Height     float64 `mapstructure:"height"`
+	Fps        float64 `mapstructure:"fps"`
+	SampleRate float64 `mapstructure:"sample_rate"`
+	Channels   float64 `mapstructure:"channels"`
+	Lang       string  `mapstructure:"lang"`
+	Bitrate    float64 `mapstructure:"bitrate"`
 }
 
 type Options struct {
 	Disabled bool   `mapstructure:"disabled"`
 	Title    string `mapstructure:"title"`
 	Comment  string `mapstructure:"comment"`
+	// Static streams run all the time, other (ondemand) streams start only when requested by clients.
+	Static bool `mapstructure:"static"`
 }
 
-func (f *Flussonic) GetMedia() (*Media, error) {
-	client := &http.Client{}
-	media := Media{Streams: make(map[string]*Stream)}
-	media.Url = "/flussonic/api/media"
-	req, err := http.NewRequest("GET", f.Url.String()+media.Url, nil)
+// Source returns host and protocol of the current source url. Credentials, path and query are dropped.
+func (s Stats) Source() (host string, protocol string) {
+	return hostAndScheme(s.Url)
+}
+
+// Host returns host of the push url. Credentials, path and query (usually containing stream key) are dropped.
+func (p Push) Host() string {
+	host, _ := hostAndScheme(p.Url)
+	return host
+}
+
+// IsRunning reports whether push is active.
+func (p Push) IsRunning() bool {
+	return p.Status == "running"
+}
+
+func hostAndScheme(rawUrl string) (string, string) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", ""
+	}
+	return u.Host, u.Scheme
+}
+
+// DvrStreams returns names of streams with enabled archive.
+func (m *Media) DvrStreams() []string {
+	var names []string
+	for name, stream := range m.Streams {
+		if stream.Stats.DvrEnabled {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (f *Flussonic) GetMedia(ctx context.Context) (*Media, error) {
+	api, err := f.apiVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(f.User, f.Password)
-	startTime := time.Now()
-	resp, err := client.Do(req)
+	if api == ApiV3 {
+		return f.getMediaV3(ctx)
+	}
+	return f.getMediaLegacy(ctx)
+}
+
+func (f *Flussonic) getMediaLegacy(ctx context.Context) (*Media, error) {
+	media := Media{Streams: make(map[string]*Stream)}
+	media.Url = "/flussonic/api/media"
+	resp, duration, err := f.get(ctx, media.Url)
 	if err != nil {
 		return nil, err
 	}
-	media.RequestDuration = time.Since(startTime).Seconds()
+	media.RequestDuration = duration
 	defer resp.Body.Close()
 
 	type entry struct {
@@ -103,3 +170,48 @@ func (f *Flussonic) GetMedia() (*Media, error) {
 	}
 	return &media, nil
 }
+
+func (f *Flussonic) getMediaV3(ctx context.Context) (*Media, error) {
+	media := Media{Streams: make(map[string]*Stream)}
+	media.Url = v3StreamsPath
+
+	type page struct {
+		Streams []map[string]interface{} `json:"streams"`
+		Next    string                   `json:"next"`
+	}
+	duration, err := f.getV3Pages(ctx, media.Url, func(body io.Reader) (string, error) {
+		var p page
+		if err := json.NewDecoder(body).Decode(&p); err != nil {
+			return "", err
+		}
+		for _, item := range p.Streams {
+			stream, err := decodeV3Stream(item)
+			if err != nil {
+				return "", err
+			}
+			media.Streams[stream.Name] = stream
+		}
+		return p.Next, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	media.RequestDuration = duration
+	return &media, nil
+}
+
+// decodeV3Stream fills legacy model from v3 stream. In v3 options are top level fields and
+// dvr is an object which is present only if archive is enabled.
+func decodeV3Stream(item map[string]interface{}) (*Stream, error) {
+	var stream Stream
+	if err := mapstructure.Decode(item, &stream); err != nil {
+		return nil, err
+	}
+	if err := mapstructure.Decode(item, &stream.Options); err != nil {
+		return nil, err
+	}
+	if dvr, ok := item["dvr"]; ok && dvr != nil {
+		stream.Stats.DvrEnabled = true
+	}
+	return &stream, nil
+}
@@ -0,0 +1,91 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"sort"
+)
+
+// DefaultModule is used by probe when module is not specified.
+const DefaultModule = "default"
+
+// Module holds credentials and options for probing flussonics which are not listed in config.
+type Module struct {
+	flussonic *Flussonic
+}
+
+// ParseModules parses probe modules. Module "default" without credentials is added if it's not configured.
+func ParseModules(v *viper.Viper, key string) (map[string]*Module, error) {
+	if v == nil {
+		return nil, fmt.Errorf("modules configuration not found")
+	}
+
+	var confs map[string]flussonicConfig
+	errs := unmarshalKey(v, key, &confs, &map[string]flussonicConfig{})
+	if _, ok := confs[DefaultModule]; !ok {
+		if confs == nil {
+			confs = make(map[string]flussonicConfig)
+		}
+		confs[DefaultModule] = flussonicConfig{}
+	}
+
+	//modules are parsed in order of names, so errors are reported in the same order every time
+	names := make([]string, 0, len(confs))
+	for name := range confs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	modules := make(map[string]*Module)
+	for _, name := range names {
+		conf := confs[name]
+		// target is passed by probe request
+		conf.Url = ""
+		conf.InstanceName = ""
+		prefix := fmt.Sprintf("%s.%s", key, name)
+		conf, err := conf.expandEnv()
+		moduleErrs := prefixErrors(prefix, err)
+		flus, err := conf.newFlussonic()
+		moduleErrs = moduleErrs.Append(prefixErrors(prefix, err))
+		if len(moduleErrs) > 0 {
+			errs = append(errs, moduleErrs...)
+			continue
+		}
+		modules[name] = &Module{flussonic: flus}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return modules, nil
+}
+
+// NewFlussonic returns flussonic with target url and module options.
+// All flussonics of the module share its http client.
+func (m *Module) NewFlussonic(target string) (*Flussonic, error) {
+	flussUrl, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	flus := *m.flussonic
+	flus.Url = flussUrl
+	flus.InstanceName = flussUrl.Host
+	flus.resolved = &resolvedApi{}
+	return &flus, nil
+}
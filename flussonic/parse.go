@@ -19,10 +19,12 @@ package flussonic
 
 import (
 	"fmt"
-	"github.com/mef13/flussonic_exporter/logger"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
-	"go.uber.org/zap"
+	"net/http"
 	"net/url"
+	"strings"
+	"time"
 )
 
 type Flussonic struct {
@@ -31,50 +33,276 @@ type Flussonic struct {
 	Password       string
 	ScrapeInterval string
 	InstanceName   string
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Timeout        time.Duration
+	UserAgent      string
+	Proxy          *url.URL
+	MaxCacheAge    time.Duration
+	// SkipDisabledStreams excludes streams disabled in flussonic config from metrics.
+	SkipDisabledStreams bool
+	// DvrMetrics enables requesting archive status of every dvr enabled stream.
+	DvrMetrics bool
+	// DiskMetrics enables requesting disks status.
+	DiskMetrics bool
+	// SessionDetails enables session duration and bytes histograms and user agent and country breakdowns.
+	SessionDetails bool
+	// SessionsTopN limits user agent families and countries exported, others are summed as "other".
+	SessionsTopN int
+	// Api is ApiLegacy, ApiV3 or ApiAuto.
+	Api      string
+	resolved *resolvedApi
+	client   *http.Client
 }
 
-func ParseConfig(v *viper.Viper, key string) ([]*Flussonic, error) {
-	type f struct {
-		Url            string `mapstructure:"url"`
-		User           string `mapstructure:"user"`
-		Password       string `mapstructure:"password"`
-		ScrapeInterval string `mapstructure:"scrape-interval"`
-		InstanceName   string `mapstructure:"instance-name"`
-	}
+type flussonicConfig struct {
+	Url            string `mapstructure:"url"`
+	User           string `mapstructure:"user"`
+	Password       string `mapstructure:"password"`
+	PasswordFile   string `mapstructure:"password-file"`
+	ScrapeInterval string `mapstructure:"scrape-interval"`
+	InstanceName   string `mapstructure:"instance-name"`
+	ConnectTimeout string `mapstructure:"connect-timeout"`
+	ReadTimeout    string `mapstructure:"read-timeout"`
+	Timeout        string `mapstructure:"timeout"`
+	UserAgent      string `mapstructure:"user-agent"`
+	Proxy          string `mapstructure:"proxy"`
+	MaxCacheAge    string `mapstructure:"max-cache-age"`
+	SkipDisabled   bool   `mapstructure:"skip-disabled-streams"`
+	DvrMetrics     bool   `mapstructure:"dvr-metrics"`
+	DiskMetrics    bool   `mapstructure:"disk-metrics"`
+	Api            string `mapstructure:"api"`
+	SessionDetails bool   `mapstructure:"session-details"`
+	SessionsTopN   int    `mapstructure:"sessions-top-n"`
+}
 
+// ParseConfig parses and validates flussonics list. All problems found are returned together as ConfigErrors.
+// Empty list is valid, exporter may only probe flussonics which are not listed in config.
+func ParseConfig(v *viper.Viper, key string) ([]*Flussonic, error) {
 	if v == nil {
 		return nil, fmt.Errorf("flussonic configuration not found")
 	}
 
-	var confs []f
-	err := v.UnmarshalKey(key, &confs)
-	if err != nil {
-		return nil, err
-	}
+	var confs []flussonicConfig
+	errs := unmarshalKey(v, key, &confs, &[]flussonicConfig{})
 
 	var fluss []*Flussonic
-	for _, conf := range confs {
-		flussUrl, err := url.Parse(conf.Url)
-		if err != nil {
-			logger.Error("error parsing flussonic url", zap.String("url", conf.Url))
-			return nil, err
+	instanceNames := make(map[string]int)
+	urls := make(map[string]int)
+	for i, conf := range confs {
+		prefix := fmt.Sprintf("%s[%d]", key, i)
+		rawUrl := conf.Url
+		conf, err := conf.expandEnv()
+		entryErrs := prefixErrors(prefix, err)
+		//url which can't be expanded is already reported
+		var flussUrl *url.URL
+		if _, err := expandEnv(rawUrl); err == nil {
+			flussUrl, err = parseTarget(conf.Url)
+			if err != nil {
+				entryErrs = append(entryErrs, fmt.Errorf("%s: url: %w", prefix, err))
+			}
 		}
-		if conf.ScrapeInterval == "" {
-			conf.ScrapeInterval = "60s"
+		//other options are validated even if url is invalid, so all errors are reported at once
+		conf.Url = ""
+		if flussUrl != nil {
+			conf.Url = flussUrl.String()
 		}
-		if conf.InstanceName == "" {
-			conf.InstanceName = flussUrl.Host
+		flus, err := conf.newFlussonic()
+		entryErrs = entryErrs.Append(prefixErrors(prefix, err))
+		//duplicates are checked even if entry has other errors, they only need valid url
+		if flussUrl != nil {
+			instanceName := conf.InstanceName
+			if instanceName == "" {
+				instanceName = flussUrl.Host
+			}
+			if j, ok := urls[conf.Url]; ok {
+				entryErrs = append(entryErrs, fmt.Errorf("%s: url %q is already used by %s[%d]", prefix, conf.Url, key, j))
+			} else {
+				urls[conf.Url] = i
+			}
+			if j, ok := instanceNames[instanceName]; ok {
+				entryErrs = append(entryErrs, fmt.Errorf("%s: instance-name %q is already used by %s[%d]",
+					prefix, instanceName, key, j))
+			} else {
+				instanceNames[instanceName] = i
+			}
 		}
-		fluss = append(fluss, &Flussonic{
-			Url:            flussUrl,
-			User:           conf.User,
-			Password:       conf.Password,
-			ScrapeInterval: conf.ScrapeInterval,
-			InstanceName:   conf.InstanceName,
-		})
-	}
-	if len(fluss) == 0 {
-		return nil, fmt.Errorf("flussonic configuration not found")
+		if len(entryErrs) > 0 {
+			errs = append(errs, entryErrs...)
+			continue
+		}
+		fluss = append(fluss, flus)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
 	}
 	return fluss, nil
 }
+
+// unmarshalKey unmarshals key section into out and returns all its problems, including unknown keys.
+// Strict unmarshal into strict may skip entries with unknown keys, so out is unmarshalled separately
+// to validate these entries too, its errors are already reported by strict one.
+func unmarshalKey(v *viper.Viper, key string, out interface{}, strict interface{}) ConfigErrors {
+	errs := decodeErrors(key, v.UnmarshalKey(key, strict, errorUnused))
+	_ = v.UnmarshalKey(key, out)
+	return errs
+}
+
+// errorUnused makes unmarshal fail on keys which don't match any option, e.g. misspelled ones.
+func errorUnused(c *mapstructure.DecoderConfig) {
+	c.ErrorUnused = true
+}
+
+// decodeErrors splits unmarshal error of key section, so every wrong key is reported separately.
+func decodeErrors(key string, err error) ConfigErrors {
+	var errs ConfigErrors
+	if err == nil {
+		return errs
+	}
+	if decodeErr, ok := err.(*mapstructure.Error); ok {
+		for _, message := range decodeErr.Errors {
+			errs = append(errs, fmt.Errorf("%s: %s", key, message))
+		}
+		return errs
+	}
+	return append(errs, fmt.Errorf("%s: %w", key, err))
+}
+
+// prefixErrors adds prefix to every error of err, so it's clear which entry is wrong.
+func prefixErrors(prefix string, err error) ConfigErrors {
+	var errs ConfigErrors
+	for _, e := range ConfigErrors(nil).Append(err) {
+		errs = append(errs, fmt.Errorf("%s: %w", prefix, e))
+	}
+	return errs
+}
+
+// parseTarget parses flussonic url, which must be http(s) url with host.
+func parseTarget(target string) (*url.URL, error) {
+	if target == "" {
+		return nil, fmt.Errorf("url is empty")
+	}
+	flussUrl, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if flussUrl.Scheme != "http" && flussUrl.Scheme != "https" || flussUrl.Host == "" {
+		return nil, fmt.Errorf("must be http(s) url, got %q", target)
+	}
+	//api paths are appended to url, so http://host/ is the same flussonic as http://host
+	flussUrl.Path = strings.TrimRight(flussUrl.Path, "/")
+	flussUrl.RawPath = strings.TrimRight(flussUrl.RawPath, "/")
+	return flussUrl, nil
+}
+
+// newFlussonic applies defaults to config entry, validates it and creates flussonic with its http client.
+// Url is not validated, it's empty for modules.
+func (conf flussonicConfig) newFlussonic() (*Flussonic, error) {
+	var errs ConfigErrors
+	flussUrl, err := url.Parse(conf.Url)
+	if err != nil {
+		return nil, append(errs, fmt.Errorf("url: %w", err))
+	}
+	if conf.ScrapeInterval == "" {
+		conf.ScrapeInterval = "60s"
+	}
+	if _, err := parseDuration(conf.ScrapeInterval, 0); err != nil {
+		errs = append(errs, fmt.Errorf("scrape-interval: %w", err))
+	}
+	if conf.InstanceName == "" {
+		conf.InstanceName = flussUrl.Host
+	}
+	if conf.UserAgent == "" {
+		conf.UserAgent = defaultUserAgent
+	}
+	if conf.PasswordFile != "" {
+		if conf.Password != "" {
+			errs = append(errs, fmt.Errorf("password-file: password and password-file are mutually exclusive"))
+		} else if password, err := readSecretFile(conf.PasswordFile); err != nil {
+			errs = append(errs, fmt.Errorf("password-file: %w", err))
+		} else {
+			conf.Password = password
+		}
+	}
+	connectTimeout, err := parseDuration(conf.ConnectTimeout, defaultConnectTimeout)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("connect-timeout: %w", err))
+	}
+	readTimeout, err := parseDuration(conf.ReadTimeout, defaultReadTimeout)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read-timeout: %w", err))
+	}
+	timeout, err := parseDuration(conf.Timeout, defaultTimeout)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("timeout: %w", err))
+	}
+	proxy, err := parseProxy(conf.Proxy)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("proxy: %w", err))
+	}
+	maxCacheAge, err := parseDuration(conf.MaxCacheAge, 0)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("max-cache-age: %w", err))
+	}
+	api, err := parseApi(conf.Api)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("api: %w", err))
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	if conf.SessionsTopN <= 0 {
+		conf.SessionsTopN = defaultSessionsTopN
+	}
+	flus := &Flussonic{
+		Url:            flussUrl,
+		User:           conf.User,
+		Password:       conf.Password,
+		ScrapeInterval: conf.ScrapeInterval,
+		InstanceName:   conf.InstanceName,
+		ConnectTimeout: connectTimeout,
+		ReadTimeout:    readTimeout,
+		Timeout:        timeout,
+		UserAgent:      conf.UserAgent,
+		Proxy:          proxy,
+		MaxCacheAge:    maxCacheAge,
+
+		SkipDisabledStreams: conf.SkipDisabled,
+		DvrMetrics:          conf.DvrMetrics,
+		DiskMetrics:         conf.DiskMetrics,
+		SessionDetails:      conf.SessionDetails,
+		SessionsTopN:        conf.SessionsTopN,
+		Api:                 api,
+		resolved:            &resolvedApi{},
+	}
+	flus.client = newHTTPClient(flus)
+	return flus, nil
+}
+
+// Equal reports whether f and o have the same configuration, so scrape job of f doesn't have to be replaced.
+func (f *Flussonic) Equal(o *Flussonic) bool {
+	return urlString(f.Url) == urlString(o.Url) &&
+		f.User == o.User &&
+		f.Password == o.Password &&
+		f.ScrapeInterval == o.ScrapeInterval &&
+		f.InstanceName == o.InstanceName &&
+		f.ConnectTimeout == o.ConnectTimeout &&
+		f.ReadTimeout == o.ReadTimeout &&
+		f.Timeout == o.Timeout &&
+		f.UserAgent == o.UserAgent &&
+		urlString(f.Proxy) == urlString(o.Proxy) &&
+		f.MaxCacheAge == o.MaxCacheAge &&
+		f.SkipDisabledStreams == o.SkipDisabledStreams &&
+		f.DvrMetrics == o.DvrMetrics &&
+		f.DiskMetrics == o.DiskMetrics &&
+		f.SessionDetails == o.SessionDetails &&
+		f.SessionsTopN == o.SessionsTopN &&
+		f.Api == o.Api
+}
+
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,103 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"errors"
+	"github.com/spf13/viper"
+	"strings"
+	"testing"
+)
+
+// parseTestConfig parses flussonics list and returns messages of all errors found.
+func parseTestConfig(t *testing.T, confs ...map[string]interface{}) ([]*Flussonic, []string) {
+	entries := make([]interface{}, 0, len(confs))
+	for _, conf := range confs {
+		entries = append(entries, conf)
+	}
+	v := viper.New()
+	v.Set("flussonics", entries)
+	fluss, err := ParseConfig(v, "flussonics")
+	if err == nil {
+		return fluss, nil
+	}
+	var errs ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error is not ConfigErrors: %s", err)
+	}
+	var messages []string
+	for _, e := range errs {
+		messages = append(messages, e.Error())
+	}
+	return nil, messages
+}
+
+func TestParseConfigReportsAllErrors(t *testing.T) {
+	_, errs := parseTestConfig(t,
+		map[string]interface{}{"url": "", "scrape-interval": "abc", "connect-timeout": "-5s", "timeout": "1x",
+			"proxy": "proxy:3128"},
+		map[string]interface{}{"url": "http://${FLUSSONIC_EXPORTER_TEST_UNSET}:8081", "max-cache-age": "0s",
+			"api": "v4"},
+	)
+	expected := []string{
+		"flussonics[0]: url: url is empty",
+		"flussonics[0]: scrape-interval:",
+		`flussonics[0]: connect-timeout: must be positive, got "-5s"`,
+		"flussonics[0]: timeout:",
+		`flussonics[0]: proxy: must be http(s) or socks5 url, got "proxy:3128"`,
+		`flussonics[1]: url: environment variable "FLUSSONIC_EXPORTER_TEST_UNSET" is not set`,
+		`flussonics[1]: max-cache-age: must be positive, got "0s"`,
+		"flussonics[1]: api:",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("errors = %q, want %d errors", errs, len(expected))
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(errs[i], prefix) {
+			t.Errorf("error %d = %q, want prefix %q", i, errs[i], prefix)
+		}
+	}
+}
+
+func TestParseConfigDuplicateUrl(t *testing.T) {
+	_, errs := parseTestConfig(t,
+		map[string]interface{}{"url": "http://a:80", "instance-name": "a1"},
+		map[string]interface{}{"url": "http://a:80/", "instance-name": "a2"},
+	)
+	if len(errs) != 1 || !strings.Contains(errs[0], "is already used by flussonics[0]") {
+		t.Errorf("errors = %q, want duplicate url error", errs)
+	}
+
+	//duplicate is reported together with other errors of the entry
+	_, errs = parseTestConfig(t,
+		map[string]interface{}{"url": "http://a:80"},
+		map[string]interface{}{"url": "http://a:80", "instance-name": "a2", "timeout": "5"},
+	)
+	if len(errs) != 2 || !strings.HasPrefix(errs[0], "flussonics[1]: timeout:") ||
+		!strings.Contains(errs[1], "is already used by flussonics[0]") {
+		t.Errorf("errors = %q, want timeout and duplicate url errors", errs)
+	}
+
+	fluss, errs := parseTestConfig(t, map[string]interface{}{"url": "http://a:8081/"})
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if fluss[0].Url.String() != "http://a:8081" {
+		t.Errorf("url = %s, want trailing slash trimmed", fluss[0].Url)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envVarPattern matches ${ENV_VAR}. Plain $ is kept as is, it's common in passwords.
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${ENV_VAR} with value of environment variable, it's an error if variable is not set.
+func expandEnv(value string) (string, error) {
+	var err error
+	expanded := envVarPattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := envVarPattern.FindStringSubmatch(match)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %q is not set", name)
+		}
+		return env
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// expandEnv expands environment variables in options which may hold secrets.
+// Options which can't be expanded are cleared, so they don't fail validation once more.
+func (conf flussonicConfig) expandEnv() (flussonicConfig, error) {
+	var errs ConfigErrors
+	for _, option := range []struct {
+		key   string
+		value *string
+	}{
+		{"url", &conf.Url},
+		{"user", &conf.User},
+		{"password", &conf.Password},
+		{"password-file", &conf.PasswordFile},
+		{"proxy", &conf.Proxy},
+	} {
+		expanded, err := expandEnv(*option.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", option.key, err))
+		}
+		*option.value = expanded
+	}
+	return conf, errs.Err()
+}
+
+// readSecretFile reads secret from file, trailing newline added by editors is trimmed.
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
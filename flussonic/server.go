@@ -18,36 +18,104 @@
 package flussonic
 
 import (
+	"context"
 	"encoding/json"
-	"net/http"
-	"time"
 )
 
 type Server struct {
 	RequestDuration float64 `json:"-"`
 	Url             string  `json:"-"`
 	TotalClients    float64 `json:"total_clients"`
+	// CpuUsage and MemoryUsage are in percent, TotalMemory is in bytes.
+	// Stats are nil if flussonic doesn't report them, they differ between versions.
+	CpuUsage      *float64   `json:"cpu_usage"`
+	MemoryUsage   *float64   `json:"memory_usage"`
+	TotalMemory   *float64   `json:"total_memory"`
+	Uptime        *float64   `json:"uptime"`
+	Version       string     `json:"version"`
+	Build         flexString `json:"build"`
+	Hostname      string     `json:"hostname"`
+	SchedulerLoad *float64   `json:"scheduler_load"`
+	InputKbit     *float64   `json:"input_kbit"`
+	OutputKbit    *float64   `json:"output_kbit"`
+	LicenseValid  *bool      `json:"license_valid"`
 }
 
-func (f *Flussonic) GetServer() (*Server, error) {
-	client := &http.Client{}
+// UsedMemory returns used memory in bytes, nil if total memory or memory usage is not reported.
+func (s *Server) UsedMemory() *float64 {
+	if s.TotalMemory == nil || s.MemoryUsage == nil {
+		return nil
+	}
+	used := *s.TotalMemory * *s.MemoryUsage / 100
+	return &used
+}
+
+// flexString decodes json string or number, flussonic versions differ in build type.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = flexString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return err
+	}
+	*s = flexString(num.String())
+	return nil
+}
+
+func (f *Flussonic) GetServer(ctx context.Context) (*Server, error) {
+	api, err := f.apiVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if api == ApiV3 {
+		return f.getServerV3(ctx)
+	}
+	return f.getServerLegacy(ctx)
+}
+
+func (f *Flussonic) getServerLegacy(ctx context.Context) (*Server, error) {
 	server := Server{}
 	server.Url = "/flussonic/api/server"
-	req, err := http.NewRequest("GET", f.Url.String()+server.Url, nil)
+	resp, duration, err := f.get(ctx, server.Url)
+	if err != nil {
+		return nil, err
+	}
+	server.RequestDuration = duration
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&server)
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(f.User, f.Password)
-	startTime := time.Now()
-	resp, err := client.Do(req)
+	return &server, nil
+}
+
+// getServerV3 reads server stats from v3 config, they have the same fields as legacy server.
+func (f *Flussonic) getServerV3(ctx context.Context) (*Server, error) {
+	type config struct {
+		Hostname string `json:"hostname"`
+		Stats    Server `json:"stats"`
+	}
+	path := "/streamer/api/v3/config"
+	resp, duration, err := f.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	server.RequestDuration = time.Since(startTime).Seconds()
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&server)
+	var conf config
+	err = json.NewDecoder(resp.Body).Decode(&conf)
 	if err != nil {
 		return nil, err
 	}
+	server := conf.Stats
+	server.Url = path
+	server.RequestDuration = duration
+	if server.Hostname == "" {
+		server.Hostname = conf.Hostname
+	}
 	return &server, nil
 }
@@ -18,17 +18,36 @@
 package flussonic
 
 import (
+	"context"
 	"encoding/json"
-	"net/http"
+	"io"
 	"strings"
 	"time"
 )
 
+const defaultSessionsTopN = 10
+
+var (
+	// SessionDurationBuckets are upper bounds of session duration histogram, in seconds.
+	SessionDurationBuckets = []float64{10, 30, 60, 300, 600, 1800, 3600, 7200, 14400, 43200, 86400}
+	// SessionBytesBuckets are upper bounds of session delivered bytes histogram.
+	SessionBytesBuckets = []float64{1e5, 1e6, 1e7, 1e8, 1e9, 1e10}
+)
+
 type Sessions struct {
 	RequestDuration float64
 	Url             string
 	TotalDvrClients float64
+	Types           map[string]float64
 	Sessions        map[string]*MediaSessions
+	// UniqueIps estimates distinct client ips on the server.
+	UniqueIps *HyperLogLog
+	// UserAgents and Countries are filled only if session details are enabled.
+	UserAgents map[string]float64
+	Countries  map[string]float64
+
+	details bool
+	now     time.Time
 }
 
 type MediaSessions struct {
@@ -36,57 +55,151 @@ type MediaSessions struct {
 	DvrClients   float64
 	TotalClients float64
 	Types        map[string]float64
+	UniqueIps    *HyperLogLog
+	// Durations and Bytes are nil if session details are disabled.
+	Durations *Histogram
+	Bytes     *Histogram
+}
+
+// session is a single client session. Legacy api reports its type in type, v3 in proto.
+type session struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Proto     string  `json:"proto"`
+	Ip        string  `json:"ip"`
+	UserAgent string  `json:"user_agent"`
+	Bytes     float64 `json:"bytes"`
+	OpenedAt  float64 `json:"opened_at"`
+	Country   string  `json:"country"`
+}
+
+func newSessions(url string, details bool) *Sessions {
+	sessions := &Sessions{
+		Url:             url,
+		Sessions:        make(map[string]*MediaSessions),
+		TotalDvrClients: 0,
+		Types:           make(map[string]float64),
+		UniqueIps:       newHyperLogLog(serverHllPrecision),
+		details:         details,
+		now:             time.Now(),
+	}
+	if details {
+		sessions.UserAgents = make(map[string]float64)
+		sessions.Countries = make(map[string]float64)
+	}
+	return sessions
+}
+
+// add counts session in aggregates, session itself is not kept.
+func (s *Sessions) add(e *session) {
+	sessionType := e.Type
+	if sessionType == "" {
+		sessionType = e.Proto
+	}
+	media, ok := s.Sessions[e.Name]
+	if !ok {
+		media = &MediaSessions{
+			Name:         e.Name,
+			DvrClients:   0,
+			TotalClients: 0,
+			Types:        make(map[string]float64),
+			UniqueIps:    newHyperLogLog(streamHllPrecision),
+		}
+		if s.details {
+			media.Durations = newHistogram(SessionDurationBuckets)
+			media.Bytes = newHistogram(SessionBytesBuckets)
+		}
+		s.Sessions[e.Name] = media
+	}
+	media.TotalClients++
+	if strings.Contains(sessionType, "dvr") {
+		media.DvrClients++
+		s.TotalDvrClients++
+	}
+	media.Types[sessionType]++
+	s.Types[sessionType]++
+	if e.Ip != "" {
+		media.UniqueIps.add(e.Ip)
+		s.UniqueIps.add(e.Ip)
+	}
+
+	if !s.details {
+		return
+	}
+	//opened_at is in milliseconds
+	if e.OpenedAt > 0 {
+		duration := s.now.Sub(time.Unix(0, int64(e.OpenedAt)*int64(time.Millisecond))).Seconds()
+		if duration < 0 {
+			duration = 0
+		}
+		media.Durations.observe(duration)
+	}
+	media.Bytes.observe(e.Bytes)
+	s.UserAgents[userAgentFamily(e.UserAgent)]++
+	country := e.Country
+	if country == "" {
+		country = "unknown"
+	}
+	s.Countries[country]++
 }
 
-func (f *Flussonic) GetSessions() (*Sessions, error) {
-	client := &http.Client{}
-	sessions := Sessions{Sessions: make(map[string]*MediaSessions), TotalDvrClients: 0}
-	sessions.Url = "/flussonic/api/sessions"
-	req, err := http.NewRequest("GET", f.Url.String()+sessions.Url, nil)
+func (f *Flussonic) GetSessions(ctx context.Context) (*Sessions, error) {
+	api, err := f.apiVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(f.User, f.Password)
-	startTime := time.Now()
-	resp, err := client.Do(req)
+	if api == ApiV3 {
+		return f.getSessionsV3(ctx)
+	}
+	return f.getSessionsLegacy(ctx)
+}
+
+// decodeSessions decodes sessions array one by one, so memory doesn't grow with sessions count.
+func (s *Sessions) decodeSessions(dec *json.Decoder) error {
+	return decodeArrayStream(dec, func(dec *json.Decoder) error {
+		var e session
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		s.add(&e)
+		return nil
+	})
+}
+
+func (f *Flussonic) getSessionsLegacy(ctx context.Context) (*Sessions, error) {
+	sessions := newSessions("/flussonic/api/sessions", f.SessionDetails)
+	resp, duration, err := f.get(ctx, sessions.Url)
 	if err != nil {
 		return nil, err
 	}
-	sessions.RequestDuration = time.Since(startTime).Seconds()
+	sessions.RequestDuration = duration
 	defer resp.Body.Close()
 
-	type entry struct {
-		Name string `json:"name"`
-		Type string `json:"type"`
-	}
-	type head struct {
-		Event    string  `json:"event"`
-		Sessions []entry `json:"sessions"`
+	err = decodeObjectStream(resp.Body, map[string]func(dec *json.Decoder) error{
+		"sessions": sessions.decodeSessions,
+	})
+	if err != nil {
+		return nil, err
 	}
+	return sessions, nil
+}
+
+func (f *Flussonic) getSessionsV3(ctx context.Context) (*Sessions, error) {
+	sessions := newSessions("/streamer/api/v3/sessions", f.SessionDetails)
 
-	var entrys head
-	err = json.NewDecoder(resp.Body).Decode(&entrys)
+	duration, err := f.getV3Pages(ctx, sessions.Url, func(body io.Reader) (string, error) {
+		next := ""
+		err := decodeObjectStream(body, map[string]func(dec *json.Decoder) error{
+			"sessions": sessions.decodeSessions,
+			"next": func(dec *json.Decoder) error {
+				return dec.Decode(&next)
+			},
+		})
+		return next, err
+	})
 	if err != nil {
 		return nil, err
 	}
-	for _, e := range entrys.Sessions {
-		if _, ok := sessions.Sessions[e.Name]; !ok {
-			sessions.Sessions[e.Name] = &MediaSessions{
-				Name:         e.Name,
-				DvrClients:   0,
-				TotalClients: 0,
-				Types:        make(map[string]float64),
-			}
-		}
-		if _, ok := sessions.Sessions[e.Name].Types[e.Type]; !ok {
-			sessions.Sessions[e.Name].Types[e.Type] = 0
-		}
-		sessions.Sessions[e.Name].TotalClients++
-		if strings.Contains(e.Type, "dvr") {
-			sessions.Sessions[e.Name].DvrClients++
-			sessions.TotalDvrClients++
-		}
-		sessions.Sessions[e.Name].Types[e.Type]++
-	}
-	return &sessions, nil
+	sessions.RequestDuration = duration
+	return sessions, nil
 }
@@ -0,0 +1,55 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package flussonic
+
+import "strings"
+
+// userAgentFamilies are checked in order, the first matching family is used.
+// Browsers are checked last, as players often mention browser engines in their user agents.
+var userAgentFamilies = []struct {
+	family   string
+	contains []string
+}{
+	{"vlc", []string{"VLC", "LibVLC"}},
+	{"exoplayer", []string{"ExoPlayer"}},
+	{"apple_coremedia", []string{"AppleCoreMedia"}},
+	{"ffmpeg", []string{"Lavf", "FFmpeg"}},
+	{"gstreamer", []string{"GStreamer"}},
+	{"kodi", []string{"Kodi"}},
+	{"smart_tv", []string{"SMART-TV", "SmartTV", "Tizen", "Web0S", "webOS"}},
+	{"edge", []string{"Edg/"}},
+	{"opera", []string{"OPR/", "Opera"}},
+	{"firefox", []string{"Firefox"}},
+	{"chrome", []string{"Chrome"}},
+	{"safari", []string{"Safari"}},
+}
+
+// userAgentFamily returns a short name of client software, so user agents can be used as label value.
+func userAgentFamily(userAgent string) string {
+	if userAgent == "" {
+		return "unknown"
+	}
+	for _, f := range userAgentFamilies {
+		for _, substr := range f.contains {
+			if strings.Contains(userAgent, substr) {
+				return f.family
+			}
+		}
+	}
+	return "other"
+}
@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/TheZeroSlave/zapsentry v1.5.0
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/getsentry/sentry-go v0.7.0
 	github.com/golang/snappy v0.0.2
 	github.com/mitchellh/mapstructure v1.1.2
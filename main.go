@@ -18,6 +18,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/mef13/flussonic_exporter/collector"
@@ -26,12 +27,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
-	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -42,7 +44,7 @@ var (
 )
 
 //init config from file
-func initViper(confPath string) {
+func initViper(confPath string) error {
 	if confPath == "" {
 		viper.SetConfigName("settings")
 		viper.SetConfigType("yaml")
@@ -52,25 +54,61 @@ func initViper(confPath string) {
 	} else {
 		viper.SetConfigFile(confPath)
 	}
+	//settings can be overridden by environment, e.g. FLUSSONIC_EXPORTER_LOG_LEVEL
+	viper.SetEnvPrefix("FLUSSONIC_EXPORTER")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
 	err := viper.ReadInConfig() // Find and read the config file
 	viper.SetDefault("log-path", "/var/log/flussonic_exporter")
 	viper.SetDefault("log-level", "info")
 	viper.SetDefault("listen-address", ":9113")
 	viper.SetDefault("metrics-path", "/metrics")
 	viper.SetDefault("exporter-metrics", true)
+	viper.SetDefault("scrape-mode", scrapeModeCron)
+	viper.SetDefault("probe-path", "/probe")
+	viper.SetDefault("watch-config", false)
 	if err != nil { // Handle errors reading the config file
-		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+		return fmt.Errorf("error read config file: %w", err)
 	}
+	return nil
 }
 
 var (
 	config = flag.String("config", "", "Path to config file")
 )
 
-func newHandler(includeExporterMetrics bool, c *collector.FlussonicCollector) http.HandlerFunc {
+const (
+	scrapeModeCron     = "cron"
+	scrapeModeOnDemand = "on-demand"
+
+	// scrapeTimeoutOffset is subtracted from prometheus scrape timeout to leave time for sending response.
+	scrapeTimeoutOffset = 500 * time.Millisecond
+)
+
+// scrapeContext limits on-demand scrape by the timeout prometheus sends in X-Prometheus-Scrape-Timeout-Seconds.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeoutSeconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || timeoutSeconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	timeout := time.Duration(timeoutSeconds * float64(time.Second))
+	if timeout > scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+func newHandler(includeExporterMetrics bool, c *collector.FlussonicCollector, onDemand bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var col prometheus.Collector = c
+		if onDemand {
+			ctx, cancel := scrapeContext(r)
+			defer cancel()
+			col = c.OnDemand(ctx)
+		}
 		registry := prometheus.NewRegistry()
-		if err := registry.Register(c); err != nil {
+		registry.MustRegister(configReloadSuccess, configReloadSuccessTime)
+		if err := registry.Register(col); err != nil {
 			logger.Error("Couldn't register collector", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			if _, err = w.Write([]byte(fmt.Sprintf("Couldn't register collector: %s", err))); err != nil {
@@ -98,41 +136,93 @@ func newHandler(includeExporterMetrics bool, c *collector.FlussonicCollector) ht
 	}
 }
 
+func newProbeHandler(modules func() map[string]*flussonic.Module) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		moduleName := r.URL.Query().Get("module")
+		if moduleName == "" {
+			moduleName = flussonic.DefaultModule
+		}
+		module, ok := modules()[moduleName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+			return
+		}
+		flus, err := module.NewFlussonic(target)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid target: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(collector.NewProbe(ctx, *flus)); err != nil {
+			logger.Error("Couldn't register probe collector", zap.Error(err))
+			http.Error(w, fmt.Sprintf("Couldn't register collector: %s", err), http.StatusInternalServerError)
+			return
+		}
+		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			ErrorLog:      log.NewErrorLogger(),
+			ErrorHandling: promhttp.ContinueOnError,
+		})
+		h.ServeHTTP(w, r)
+	}
+}
+
 func main() {
 	flag.CommandLine.SetOutput(os.Stdout)
 	flag.Usage = usage
-	flag.Parse()
-	initViper(*config)
+	//check-config is the first argument, flags follow it
+	args := os.Args[1:]
+	checkConfigMode := len(args) > 0 && args[0] == "check-config"
+	if checkConfigMode {
+		args = args[1:]
+	}
+	_ = flag.CommandLine.Parse(args)
+	if checkConfigMode {
+		if err := checkConfig(*config); err != nil {
+			fmt.Fprintln(os.Stderr, "config is invalid:")
+			for _, e := range flussonic.ConfigErrors(nil).Append(err) {
+				fmt.Fprintf(os.Stderr, "  %s\n", e)
+			}
+			os.Exit(1)
+		}
+		fmt.Println("config is valid")
+		return
+	}
+	if err := initViper(*config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	logger.InitLogger(viper.GetString("log-path"), viper.GetString("log-level"), viper.GetString("sentryDSN"), version)
 	logger.Info("Starting Flussonic exporter.", zap.String("version", version))
 	defer logger.Sync()
 
-	fluss, err := flussonic.ParseConfig(viper.GetViper(), "flussonics")
+	flussonicCollector := collector.NewCollector()
+
+	scrapeMode := viper.GetString("scrape-mode")
+	reload, err := newReloader(flussonicCollector, scrapeMode)
 	if err != nil {
-		logger.Error("error parse flussonics section in config", zap.Error(err))
+		logger.Error("error init scraping", zap.Error(err))
 		os.Exit(1)
 	}
-
-	flussonicCollector := collector.NewCollector()
-
-	c := cron.New()
-	c.Start()
-
-	for _, flus := range fluss {
-		jobName := fmt.Sprintf("Scrape %s", flus.InstanceName)
-		funcJob := flussonicCollector.GetCronJob(*flus)
-		job := cron.NewChain(cron.SkipIfStillRunning(logger.GetLoggerForCron(jobName))).Then(funcJob)
-		duration := fmt.Sprintf("@every %s", flus.ScrapeInterval)
-		id, err := c.AddJob(duration, job)
-		if err != nil {
-			logger.Error(fmt.Sprintf("error register task %s", jobName), zap.Error(err))
-			os.Exit(1)
-		}
-		logger.Info(fmt.Sprintf("register task %s. Next run: %s", jobName, c.Entry(id).Next.Format(time.RubyDate)))
-
+	if err := reload.load(); err != nil {
+		logger.Error("error load config", zap.Error(err))
+		os.Exit(1)
+	}
+	if err := reload.watch(viper.GetBool("watch-config")); err != nil {
+		logger.Error("error init config reload", zap.Error(err))
+		os.Exit(1)
 	}
 
-	http.Handle(viper.GetString("metrics-path"), newHandler(viper.GetBool("exporter-metrics"), flussonicCollector))
+	http.Handle(viper.GetString("metrics-path"), newHandler(viper.GetBool("exporter-metrics"), flussonicCollector,
+		scrapeMode == scrapeModeOnDemand))
+	http.Handle(viper.GetString("probe-path"), newProbeHandler(reload.currentModules))
 	server := &http.Server{Addr: viper.GetString("listen-address")}
 	logger.Info(fmt.Sprintf("listening on %s", viper.GetString("listen-address")))
 	if err := server.ListenAndServe(); err != nil {
@@ -145,6 +235,10 @@ func usage() {
 	const s = `
 flussonic_exporter is Prometheus exporter for flussonic.
 
+Usage:
+  flussonic_exporter [-config file]               run exporter
+  flussonic_exporter check-config [-config file]  validate config and exit
+
 See the docs at https://github.com/mef13/flussonic_exporter .
 `
 
@@ -0,0 +1,230 @@
+/*
+ *    Copyright 2020 Yury Makarov
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mef13/flussonic_exporter/collector"
+	"github.com/mef13/flussonic_exporter/flussonic"
+	"github.com/mef13/flussonic_exporter/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "flussonic_exporter",
+		Name:      "config_last_reload_success",
+		Help:      "flussonic_exporter: Whether the last configuration reload attempt was successful.",
+	})
+	configReloadSuccessTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "flussonic_exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "flussonic_exporter: Timestamp of the last successful configuration reload.",
+	})
+)
+
+// scheduler keeps one cron job per flussonic url in sync with config.
+type scheduler struct {
+	cron      *cron.Cron
+	collector *collector.FlussonicCollector
+	jobs      map[string]scheduledJob
+}
+
+type scheduledJob struct {
+	id   cron.EntryID
+	flus *flussonic.Flussonic
+}
+
+func newScheduler(c *collector.FlussonicCollector) *scheduler {
+	s := &scheduler{
+		cron:      cron.New(),
+		collector: c,
+		jobs:      make(map[string]scheduledJob),
+	}
+	s.cron.Start()
+	return s
+}
+
+// apply registers jobs of added instances, removes jobs of removed ones and reschedules changed ones.
+func (s *scheduler) apply(fluss []*flussonic.Flussonic) error {
+	//parse all schedules first, so invalid config doesn't leave jobs half applied
+	schedules := make(map[string]cron.Schedule, len(fluss))
+	for _, flus := range fluss {
+		schedule, err := cron.ParseStandard(fmt.Sprintf("@every %s", flus.ScrapeInterval))
+		if err != nil {
+			return fmt.Errorf("invalid scrape-interval of %s: %w", flus.InstanceName, err)
+		}
+		schedules[flus.Url.String()] = schedule
+	}
+
+	for key, job := range s.jobs {
+		if _, ok := schedules[key]; !ok {
+			s.cron.Remove(job.id)
+			delete(s.jobs, key)
+			logger.Info(fmt.Sprintf("unregister task Scrape %s", job.flus.InstanceName))
+		}
+	}
+	for _, flus := range fluss {
+		key := flus.Url.String()
+		if job, ok := s.jobs[key]; ok {
+			if job.flus.Equal(flus) {
+				continue
+			}
+			s.cron.Remove(job.id)
+		}
+		jobName := fmt.Sprintf("Scrape %s", flus.InstanceName)
+		funcJob := s.collector.GetCronJob(*flus)
+		job := cron.NewChain(cron.SkipIfStillRunning(logger.GetLoggerForCron(jobName))).Then(funcJob)
+		id := s.cron.Schedule(schedules[key], job)
+		s.jobs[key] = scheduledJob{id: id, flus: flus}
+		logger.Info(fmt.Sprintf("register task %s. Next run: %s", jobName, s.cron.Entry(id).Next.Format(time.RubyDate)))
+	}
+	s.collector.Retain(fluss)
+	return nil
+}
+
+// reloader applies flussonics and modules sections of config, on start and on every reload.
+type reloader struct {
+	sync      sync.Mutex
+	collector *collector.FlussonicCollector
+	// scheduler is nil in on-demand mode.
+	scheduler *scheduler
+	modules   atomic.Value
+}
+
+func newReloader(c *collector.FlussonicCollector, scrapeMode string) (*reloader, error) {
+	r := &reloader{collector: c}
+	switch scrapeMode {
+	case scrapeModeCron:
+		r.scheduler = newScheduler(c)
+	case scrapeModeOnDemand:
+	default:
+		return nil, fmt.Errorf("unknown scrape-mode %q", scrapeMode)
+	}
+	return r, nil
+}
+
+// load parses config already read by viper and applies it. On error previous config stays in use.
+func (r *reloader) load() error {
+	fluss, modules, err := parseConfig(viper.GetViper())
+	if err != nil {
+		return err
+	}
+
+	if r.scheduler != nil {
+		if err := r.scheduler.apply(fluss); err != nil {
+			return err
+		}
+	} else {
+		r.collector.SetTargets(fluss)
+		r.collector.Retain(fluss)
+		logger.Info("flussonics will be scraped on each request", zap.Int("count", len(fluss)))
+	}
+	r.modules.Store(modules)
+	configReloadSuccess.Set(1)
+	configReloadSuccessTime.SetToCurrentTime()
+	return nil
+}
+
+// reload re-reads config file and applies it.
+func (r *reloader) reload() {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+	if err := viper.ReadInConfig(); err != nil {
+		configReloadSuccess.Set(0)
+		logger.Error("error reload config", zap.Error(err))
+		return
+	}
+	if err := r.load(); err != nil {
+		configReloadSuccess.Set(0)
+		logger.Error("error reload config", zap.Error(err))
+		return
+	}
+	logger.Info("config reloaded")
+}
+
+// currentModules returns probe modules of the last successfully applied config.
+func (r *reloader) currentModules() map[string]*flussonic.Module {
+	return r.modules.Load().(map[string]*flussonic.Module)
+}
+
+// watch reloads config on SIGHUP and, if watchConfig is set, on config file change.
+// Both are handled by one goroutine, so config is read by viper only in reload.
+func (r *reloader) watch(watchConfig bool) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	//nil channels are never ready, so file events are ignored if watching is disabled
+	var (
+		events  <-chan fsnotify.Event
+		errs    <-chan error
+		changed func(fsnotify.Event) bool
+	)
+	if watchConfig {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("error watch config: %w", err)
+		}
+		configFile := filepath.Clean(viper.ConfigFileUsed())
+		//directory is watched, editors and kubernetes replace config file instead of writing it
+		if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+			watcher.Close()
+			return fmt.Errorf("error watch config: %w", err)
+		}
+		events, errs = watcher.Events, watcher.Errors
+		realConfigFile, _ := filepath.EvalSymlinks(configFile)
+		changed = func(event fsnotify.Event) bool {
+			currentConfigFile, _ := filepath.EvalSymlinks(configFile)
+			//symlink is switched to another file, e.g. on kubernetes configmap update
+			if currentConfigFile != "" && currentConfigFile != realConfigFile {
+				realConfigFile = currentConfigFile
+				return true
+			}
+			return filepath.Clean(event.Name) == configFile && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				logger.Info("received SIGHUP, reloading config")
+				r.reload()
+			case event := <-events:
+				if changed(event) {
+					logger.Info("config file changed", zap.String("file", event.Name))
+					r.reload()
+				}
+			case err := <-errs:
+				logger.Error("error watch config", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}